@@ -0,0 +1,133 @@
+package mapstructure
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"time"
+)
+
+// EncodeHookFunc is the callback function that can be used for
+// data transformations when encoding Go values into basic types.
+// It mirrors DecodeHookFunc: see EncodeHookFuncType,
+// EncodeHookFuncKind and EncodeHookFuncValue for the valid
+// signatures. Unlike decode hooks there is no target type, since
+// encoding always produces plain values.
+type EncodeHookFunc interface{}
+
+// EncodeHookFuncType is an EncodeHookFunc which has complete
+// information about the source type.
+type EncodeHookFuncType func(reflect.Type, interface{}) (interface{}, error)
+
+// EncodeHookFuncKind is an EncodeHookFunc which knows only the
+// source Kind.
+type EncodeHookFuncKind func(reflect.Kind, interface{}) (interface{}, error)
+
+// EncodeHookFuncValue is an EncodeHookFunc which has complete
+// access to the source reflect.Value.
+type EncodeHookFuncValue func(reflect.Value) (interface{}, error)
+
+// typedEncodeHook takes a raw EncodeHookFunc (an interface{}) and turns
+// it into the proper EncodeHookFunc type, such as EncodeHookFuncType.
+func typedEncodeHook(h EncodeHookFunc) EncodeHookFunc {
+	// Create variables here so we can reference them with the reflect pkg
+	var f1 EncodeHookFuncType
+	var f2 EncodeHookFuncKind
+	var f3 EncodeHookFuncValue
+
+	// Fill in the variables into this interface and the rest is done
+	// automatically using the reflect package.
+	potential := []interface{}{f1, f2, f3}
+
+	v := reflect.ValueOf(h)
+	vt := v.Type()
+	for _, raw := range potential {
+		pt := reflect.ValueOf(raw).Type()
+		if vt.ConvertibleTo(pt) {
+			return v.Convert(pt).Interface()
+		}
+	}
+
+	return nil
+}
+
+// EncodeHookExec executes the given encode hook against the source
+// value. This should be used since it'll naturally degrade to the
+// simpler Kind and Type based signatures.
+func EncodeHookExec(
+	raw EncodeHookFunc,
+	from reflect.Value) (interface{}, error) {
+
+	switch f := typedEncodeHook(raw).(type) {
+	case EncodeHookFuncType:
+		return f(from.Type(), from.Interface())
+	case EncodeHookFuncKind:
+		return f(from.Kind(), from.Interface())
+	case EncodeHookFuncValue:
+		return f(from)
+	default:
+		return nil, errors.New("invalid encode hook signature")
+	}
+}
+
+// ComposeEncodeHookFunc creates a single EncodeHookFunc that
+// automatically composes multiple EncodeHookFuncs.
+//
+// The composed funcs are called in order, with the result of the
+// previous transformation.
+func ComposeEncodeHookFunc(fs ...EncodeHookFunc) EncodeHookFunc {
+	return func(f reflect.Value) (interface{}, error) {
+		var err error
+		data := f.Interface()
+
+		newFrom := f
+		for _, f1 := range fs {
+			data, err = EncodeHookExec(f1, newFrom)
+			if err != nil {
+				return nil, err
+			}
+			newFrom = reflect.ValueOf(data)
+		}
+
+		return data, nil
+	}
+}
+
+// TimeToStringHookFunc returns an EncodeHookFunc that converts
+// time.Time to a string in the given layout. It is the encode-side
+// counterpart of StringToTimeHookFunc.
+//
+// If formatZero is false, the zero time is emitted as an empty string
+// rather than the formatted zero value, which round-trips cleanly with
+// decode hooks that treat "" as unset.
+func TimeToStringHookFunc(layout string, formatZero bool) EncodeHookFunc {
+	return func(
+		f reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f != reflect.TypeOf(time.Time{}) {
+			return data, nil
+		}
+
+		t := data.(time.Time)
+		if t.IsZero() && !formatZero {
+			return "", nil
+		}
+
+		return t.Format(layout), nil
+	}
+}
+
+// IPToStringHookFunc returns an EncodeHookFunc that converts net.IP
+// to its string form. It is the encode-side counterpart of
+// StringToIPHookFunc.
+func IPToStringHookFunc() EncodeHookFunc {
+	return func(
+		f reflect.Type,
+		data interface{}) (interface{}, error) {
+		if f != reflect.TypeOf(net.IP{}) {
+			return data, nil
+		}
+
+		return data.(net.IP).String(), nil
+	}
+}
@@ -0,0 +1,164 @@
+package mapstructure
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComposeEncodeHookFunc(t *testing.T) {
+	f1 := func(
+		f reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return data.(string) + "foo", nil
+	}
+
+	f2 := func(
+		f reflect.Kind,
+		data interface{}) (interface{}, error) {
+		return data.(string) + "bar", nil
+	}
+
+	f := ComposeEncodeHookFunc(f1, f2)
+
+	result, err := EncodeHookExec(f, reflect.ValueOf(""))
+	if err != nil {
+		t.Fatalf("bad: %s", err)
+	}
+	if result.(string) != "foobar" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestTimeToStringHookFunc(t *testing.T) {
+	timeValue := time.Date(2022, 12, 7, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		f          reflect.Value
+		formatZero bool
+		result     interface{}
+		err        bool
+	}{
+		{reflect.ValueOf(timeValue), false, "2022-12-07T12:00:00Z", false},
+		{reflect.ValueOf(time.Time{}), false, "", false},
+		{reflect.ValueOf(time.Time{}), true, "0001-01-01T00:00:00Z", false},
+		{reflect.ValueOf("foo"), false, "foo", false},
+	}
+
+	for i, tc := range cases {
+		f := TimeToStringHookFunc(time.RFC3339, tc.formatZero)
+		actual, err := EncodeHookExec(f, tc.f)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestTimeToStringHookFunc_roundTrip(t *testing.T) {
+	timeValue := time.Date(2022, 12, 7, 12, 0, 0, 0, time.UTC)
+
+	encoded, err := EncodeHookExec(
+		TimeToStringHookFunc(time.RFC3339, false),
+		reflect.ValueOf(timeValue))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	timeType := reflect.ValueOf(time.Time{})
+	decoded, err := DecodeHookExec(
+		StringToTimeHookFunc(time.RFC3339),
+		"", reflect.ValueOf(encoded), timeType)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, timeValue) {
+		t.Fatalf("bad: %#v", decoded)
+	}
+}
+
+func TestIPToStringHookFunc(t *testing.T) {
+	f := IPToStringHookFunc()
+
+	cases := []struct {
+		f      reflect.Value
+		result interface{}
+		err    bool
+	}{
+		{reflect.ValueOf(net.ParseIP("10.0.0.1")), "10.0.0.1", false},
+		{reflect.ValueOf("foo"), "foo", false},
+	}
+
+	for i, tc := range cases {
+		actual, err := EncodeHookExec(f, tc.f)
+		if tc.err != (err != nil) {
+			t.Fatalf("case %d: expected err %#v", i, tc.err)
+		}
+		if !reflect.DeepEqual(actual, tc.result) {
+			t.Fatalf(
+				"case %d: expected %#v, got %#v",
+				i, tc.result, actual)
+		}
+	}
+}
+
+func TestEncoder_RoundTrip(t *testing.T) {
+	type Config struct {
+		Name    string    `mapstructure:"name"`
+		Created time.Time `mapstructure:"created"`
+		Addr    net.IP    `mapstructure:"addr"`
+	}
+
+	input := Config{
+		Name:    "server",
+		Created: time.Date(2022, 12, 7, 12, 0, 0, 0, time.UTC),
+		Addr:    net.ParseIP("10.0.0.1"),
+	}
+
+	encoder, err := NewEncoder(&EncoderConfig{
+		EncodeHook: ComposeEncodeHookFunc(
+			TimeToStringHookFunc(time.RFC3339, false),
+			IPToStringHookFunc(),
+		),
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	encoded, err := encoder.Encode(input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"name":    "server",
+		"created": "2022-12-07T12:00:00Z",
+		"addr":    "10.0.0.1",
+	}
+	if !reflect.DeepEqual(encoded, expected) {
+		t.Fatalf("bad: %#v", encoded)
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook: ComposeDecodeHookFunc(
+			StringToTimeHookFunc(time.RFC3339),
+			StringToIPHookFunc(),
+		),
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(encoded); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, input) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
@@ -0,0 +1,166 @@
+package mapstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EncoderConfig is the configuration that is used to create a new
+// encoder. It is the encode-side mirror of DecoderConfig.
+type EncoderConfig struct {
+	// EncodeHook, if set, will be called for every value before it is
+	// written into the result. This lets you convert rich types such
+	// as time.Time or net.IP into basic values. Compose multiple hooks
+	// with ComposeEncodeHookFunc.
+	//
+	// If an error is returned, the entire encode will fail with that
+	// error.
+	EncodeHook EncodeHookFunc
+
+	// The tag name that mapstructure reads for field names. This
+	// defaults to "mapstructure", matching the decoder.
+	TagName string
+}
+
+// An Encoder converts Go structs into map[string]interface{} values,
+// the reverse of what a Decoder does. Rich field types can be lowered
+// to basic values with encode hooks such as TimeToStringHookFunc.
+type Encoder struct {
+	config *EncoderConfig
+}
+
+// NewEncoder returns a new encoder for the given configuration.
+func NewEncoder(config *EncoderConfig) (*Encoder, error) {
+	if config.TagName == "" {
+		config.TagName = "mapstructure"
+	}
+
+	return &Encoder{config: config}, nil
+}
+
+// Encode encodes the given input, which must be a struct or a pointer
+// to a struct, into a map[string]interface{}.
+func (e *Encoder) Encode(input interface{}) (map[string]interface{}, error) {
+	val := reflect.Indirect(reflect.ValueOf(input))
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot encode non-struct type '%s'", val.Type())
+	}
+
+	result := make(map[string]interface{})
+	if err := e.encodeStruct(val, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (e *Encoder) encodeStruct(val reflect.Value, result map[string]interface{}) error {
+	structType := val.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		f := structType.Field(i)
+		v := val.Field(i)
+		if !v.CanInterface() {
+			continue
+		}
+
+		tagValue := f.Tag.Get(e.config.TagName)
+		keyName := f.Name
+
+		squash := false
+		skip := false
+		tagParts := strings.Split(tagValue, ",")
+		if tagParts[0] == "-" {
+			continue
+		}
+		if tagParts[0] != "" {
+			keyName = tagParts[0]
+		}
+		for _, tag := range tagParts[1:] {
+			if tag == "omitempty" && isEmptyValue(v) {
+				skip = true
+				break
+			}
+
+			if tag == "squash" {
+				squash = true
+			}
+		}
+		if skip {
+			continue
+		}
+
+		if squash {
+			sv := reflect.Indirect(v)
+			if sv.Kind() != reflect.Struct {
+				return fmt.Errorf("cannot squash non-struct type '%s'", v.Type())
+			}
+			if err := e.encodeStruct(sv, result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		encoded, err := e.encodeValue(v)
+		if err != nil {
+			return err
+		}
+		result[keyName] = encoded
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeValue(val reflect.Value) (interface{}, error) {
+	if !val.IsValid() {
+		return nil, nil
+	}
+
+	if e.config.EncodeHook != nil {
+		data, err := EncodeHookExec(e.config.EncodeHook, val)
+		if err != nil {
+			return nil, err
+		}
+
+		val = reflect.ValueOf(data)
+		if !val.IsValid() {
+			return nil, nil
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return nil, nil
+		}
+		return e.encodeValue(val.Elem())
+	case reflect.Struct:
+		result := make(map[string]interface{})
+		if err := e.encodeStruct(val, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case reflect.Map:
+		result := make(map[string]interface{})
+		for _, k := range val.MapKeys() {
+			encoded, err := e.encodeValue(val.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprintf("%v", k.Interface())] = encoded
+		}
+		return result, nil
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			encoded, err := e.encodeValue(val.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = encoded
+		}
+		return result, nil
+	default:
+		return val.Interface(), nil
+	}
+}
@@ -3,14 +3,101 @@ package mapstructure
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 )
 
+// DecodeError is returned when a single value cannot be decoded. It
+// carries the dotted field path (e.g. "server.tls.path"), the expected
+// and actual Go types, and the offending value so callers can
+// type-assert and inspect where a decode failed. Callers that only
+// check err != nil are unaffected.
+type DecodeError struct {
+	// Path is the dotted path of the field that failed to decode.
+	Path string
+
+	// Expected is the type of the target value.
+	Expected reflect.Type
+
+	// Actual is the type of the input value.
+	Actual reflect.Type
+
+	// Value is the raw input value.
+	Value interface{}
+
+	// Err is the underlying error, if the failure came from a
+	// lower-level parse rather than a type mismatch.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("'%s': %s", e.Path, e.Err)
+	}
+	return fmt.Sprintf(
+		"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
+		e.Path, e.Expected, e.Actual, e.Value)
+}
+
+// Unwrap returns the underlying error, if any, for use with errors.Is
+// and errors.As.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a slice of the individual errors that occurred in the
+// course of a single decode. It implements the error interface by
+// joining them, using the same output as Error, but callers can also
+// range over the underlying errors. Use errors.As with a *Errors
+// target to extract it from a decode error.
+type Errors []error
+
+func (e Errors) Error() string {
+	points := make([]string, len(e))
+	for i, err := range e {
+		points[i] = fmt.Sprintf("* %s", err)
+	}
+
+	sort.Strings(points)
+	return fmt.Sprintf(
+		"%d error(s) decoding:\n\n%s",
+		len(e), strings.Join(points, "\n"))
+}
+
 // Error implements the error interface and can represents multiple
 // errors that occur in the course of a single decode.
 type Error struct {
 	Errors []string
+
+	// errs holds the structured form of Errors when the error was
+	// built by the decoder itself.
+	errs Errors
+}
+
+func newError(errs []error) *Error {
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+
+	return &Error{Errors: strs, errs: errs}
+}
+
+// As extracts the structured Errors slice so that
+// errors.As(err, &Errors{}) works on decode errors.
+func (e *Error) As(target interface{}) bool {
+	t, ok := target.(*Errors)
+	if !ok {
+		return false
+	}
+
+	if e.errs != nil {
+		*t = e.errs
+	} else {
+		*t = e.WrappedErrors()
+	}
+	return true
 }
 
 func (e *Error) Error() string {
@@ -40,11 +127,14 @@ func (e *Error) WrappedErrors() []error {
 	return result
 }
 
-func appendErrors(errors []string, err error) []string {
+func appendErrors(errors []error, err error) []error {
 	switch e := err.(type) {
 	case *Error:
-		return append(errors, e.Errors...)
+		if e.errs != nil {
+			return append(errors, e.errs...)
+		}
+		return append(errors, e.WrappedErrors()...)
 	default:
-		return append(errors, e.Error())
+		return append(errors, e)
 	}
 }
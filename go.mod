@@ -1,3 +1,3 @@
 module github.com/vuuvv/mapstructure
 
-go 1.14
+go 1.21
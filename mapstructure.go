@@ -159,6 +159,8 @@
 package mapstructure
 
 import (
+	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -166,6 +168,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // DecodeHookFunc is the callback function that can be used for
@@ -200,6 +203,32 @@ type DecodeHookFuncValue func(from reflect.Value, to reflect.Value) (interface{}
 // values with name.
 type DecodeHookFuncValueWithName func(name string, from reflect.Value, to reflect.Value) (interface{}, error)
 
+// DecodeHookFuncContext is a DecodeHookFunc which additionally receives
+// a HookContext describing where the value came from, including the
+// parent map for sibling-dependent conversions.
+type DecodeHookFuncContext func(ctx HookContext, from reflect.Value, to reflect.Value) (interface{}, error)
+
+// SliceMergeMode controls how decodeSlice treats a target slice that
+// already holds elements. See the constants for the exact semantics.
+type SliceMergeMode int
+
+const (
+	// SliceMergeReplace decodes source elements over the target from
+	// index zero, allocating a fresh slice when the target is nil.
+	// This is the default and matches the historical behavior.
+	SliceMergeReplace SliceMergeMode = iota
+
+	// SliceMergeAppend appends the decoded source elements after any
+	// existing target elements.
+	SliceMergeAppend
+
+	// SliceMergeByIndex decodes source elements into the existing
+	// target elements at matching indices, so struct fields merge
+	// rather than reset. A longer source grows the slice; existing
+	// elements past the source length keep their values.
+	SliceMergeByIndex
+)
+
 // DecoderConfig is the configuration that is used to create a new decoder
 // and allows customization of various aspects of decoding.
 type DecoderConfig struct {
@@ -219,11 +248,107 @@ type DecoderConfig struct {
 	// (extra keys).
 	ErrorUnused bool
 
+	// If ErrorUnset is true, then it is an error for there to exist
+	// fields in the result that were not set in the decoding process
+	// (extra fields). This only applies to decoding to a struct. This
+	// will affect all nested structs as well. Fields tagged with
+	// `mapstructure:"-"` are not reported.
+	ErrorUnset bool
+
 	// ZeroFields, if set to true, will zero fields before writing them.
 	// For example, a map will be emptied before decoded values are put in
 	// it. If this is false, a map will be merged.
+	//
+	// Per target kind this means:
+	//
+	//   - Map: true empties the target first; false keeps existing
+	//     keys, with colliding keys overwritten (see also MergeMaps).
+	//   - Slice: true replaces the target with a fresh slice sized to
+	//     the source; false decodes over existing elements by index,
+	//     keeping any trailing elements (see also SliceMergeMode,
+	//     whose append/by-index modes take precedence here).
+	//   - Ptr: true allocates a fresh pointee; false decodes into the
+	//     existing pointee, merging per the rules above.
+	//   - Scalars are always overwritten; a nil source only zeroes the
+	//     target when ZeroFields is true.
 	ZeroFields bool
 
+	// DecodeNil, if set to true, records keys whose source value was
+	// explicitly nil in Metadata.ExplicitNil. This distinguishes a key
+	// that was present with a nil value from one that was absent, which
+	// matters for PATCH-style partial updates. It requires Metadata to
+	// be set and does not change how nil values are decoded.
+	DecodeNil bool
+
+	// StopOnError, if set to true, aborts decoding at the first
+	// per-field error instead of continuing and collecting every error
+	// into the returned *Error. The default preserves the collect-all
+	// behavior, which still writes partial results into fields that
+	// decoded cleanly.
+	StopOnError bool
+
+	// PostFieldHook, if set, is invoked after each field has been
+	// decoded and set, with the full field path and the decoded value.
+	// Returning an error fails that field; the error is collected into
+	// the structured *Error with the path attached, so inline
+	// validation reports exactly where the bad value lives.
+	PostFieldHook func(path string, v reflect.Value) error
+
+	// InternStrings, if set to true, deduplicates decoded string
+	// values through an internal map so identical strings share
+	// backing storage. This trades the map's bookkeeping for memory
+	// savings on documents with many repeated values, such as
+	// enum-like status fields; leave it off for documents whose
+	// strings are mostly unique.
+	InternStrings bool
+
+	// ErrorUnsupportedKinds, if set to true, makes fields of kinds the
+	// decoder cannot produce from plain data (chan, unsafe pointers,
+	// and funcs whose input isn't already a matching func) fail with a
+	// descriptive error naming the field and kind. By default such
+	// fields are skipped silently rather than panicking deep inside
+	// reflect.
+	ErrorUnsupportedKinds bool
+
+	// UseNumber, if set to true, stores numeric values destined for
+	// interface{} targets as json.Number instead of their original
+	// numeric type, mirroring json.Decoder.UseNumber. This keeps
+	// integer precision for values beyond what float64 can represent.
+	UseNumber bool
+
+	// IgnoreUntaggedFields, if set to true, skips struct fields
+	// without a mapstructure tag (or whichever TagName/TagNames are
+	// configured) entirely, so internal fields can never be populated
+	// by accidental field-name matches.
+	IgnoreUntaggedFields bool
+
+	// FieldHooks attaches decode hooks to specific fields, keyed by
+	// the struct type the field is declared on and then by the Go
+	// field name. A matching hook pre-processes the raw value for that
+	// field only, which is more precise than matching on field paths;
+	// the global DecodeHook still runs as usual afterwards.
+	FieldHooks map[reflect.Type]map[string]DecodeHookFunc
+
+	// PreserveEmptyCollections, if set to true, assigns a non-nil
+	// empty slice or map when the source collection is nil, so
+	// downstream code that distinguishes nil from empty always sees
+	// empty. By default nil sources leave the target untouched. Empty
+	// but non-nil sources always produce non-nil empty targets.
+	PreserveEmptyCollections bool
+
+	// DecodeHookRunsAfterBuiltin, if set to true, runs DecodeHook only
+	// as a fallback after the built-in conversion for a value fails,
+	// instead of before every conversion. Native conversions (int to
+	// int64, string to string, etc.) then happen without hook overhead
+	// and the hook sees only the values the decoder couldn't handle.
+	DecodeHookRunsAfterBuiltin bool
+
+	// ErrorFormatter, if non-nil, builds the error returned for a type
+	// mismatch instead of the standard DecodeError. The path is the
+	// dotted field path (e.g. "server.tls.path"). This allows callers
+	// to localize or otherwise rephrase user-facing config errors.
+	ErrorFormatter func(path string, expected, actual reflect.Type) error
+
 	// If WeaklyTypedInput is true, the decoder will make the following
 	// "weak" conversions:
 	//
@@ -243,18 +368,89 @@ type DecoderConfig struct {
 	//
 	WeaklyTypedInput bool
 
+	// EmptyStringAsZero, if set to true, makes the decoder set the zero
+	// value when an incoming string is empty and the target is a
+	// non-string scalar (bool, int, uint or float, including named
+	// types such as time.Duration). This happens before any DecodeHook
+	// runs, so hooks like StringToTimeDurationHookFunc never see the
+	// empty string.
+	EmptyStringAsZero bool
+
+	// ApplyDefaults, if set to true, makes the decoder honor "default"
+	// tag modifiers such as:
+	//
+	//  type Server struct {
+	//      Port int `mapstructure:"port,default=8080"`
+	//  }
+	//
+	// When a field has no matching key in the input, the default
+	// expression is decoded into the field instead, running through the
+	// configured DecodeHook chain and weak type conversion so that
+	// "8080" can fill an int field. Missing keys without a default keep
+	// the current behavior.
+	ApplyDefaults bool
+
+	// ErrorOnMissingRequired, if set to true, makes the decoder honor
+	// "required" tag modifiers such as:
+	//
+	//  type Config struct {
+	//      APIKey string `mapstructure:"api_key,required"`
+	//  }
+	//
+	// When a required field has no matching key in the input, the
+	// decode fails with an error listing every missing required field
+	// path instead of stopping at the first one. Absence is what is
+	// checked: an explicit nil value in the input satisfies a required
+	// pointer field.
+	ErrorOnMissingRequired bool
+
 	// Squash will squash embedded structs.  A squash tag may also be
 	// added to an individual struct field using a tag.  For example:
 	//
 	//  type Parent struct {
 	//      Child `mapstructure:",squash"`
 	//  }
+	//
+	// Only embedded structs (or pointers to structs) can be squashed.
+	// An embedded non-struct type such as `type Celsius float64` is
+	// decoded as a regular field under its type name, and tagging it
+	// with squash is an error.
 	Squash bool
 
+	// MergeMaps, if set to true, makes colliding keys merge
+	// recursively when decoding into a non-empty map: an existing
+	// nested map is decoded into rather than replaced. By default
+	// existing keys not present in the source already survive, but a
+	// colliding key's value is overwritten wholesale.
+	MergeMaps bool
+
+	// SliceMergeMode controls whether decoding a slice replaces the
+	// existing target elements, appends after them, or merges into
+	// them by index. See the SliceMerge constants.
+	SliceMergeMode SliceMergeMode
+
+	// SquashTypes lists embedded struct types that are always
+	// squashed, as if they carried a ",squash" tag. This helps when
+	// the embedded type comes from a third-party package whose tags
+	// cannot be edited. A pointer type and its element are treated the
+	// same, and explicit ",squash" tags keep working alongside the
+	// list.
+	SquashTypes []reflect.Type
+
 	// Metadata is the struct that will contain extra metadata about
 	// the decoding. If this is nil, then no metadata will be tracked.
 	Metadata *Metadata
 
+	// TrackTypes, if set to true, additionally records the source and
+	// target Go types of every decoded key in Metadata.Types. It has
+	// no effect when Metadata is nil.
+	TrackTypes bool
+
+	// CaptureInput, if set to true, retains the raw top-level input in
+	// Metadata.Input so audit and debug flows can re-inspect keys the
+	// decoder ignored. It has no effect when Metadata is nil.
+	CaptureInput bool
+
 	// Result is a pointer to the struct that will contain the decoded
 	// value.
 	Result interface{}
@@ -263,12 +459,57 @@ type DecoderConfig struct {
 	// defaults to "mapstructure"
 	TagName string
 
+	// TagNames is an ordered fallback list of tag names to read for
+	// field names; the first tag present on a field wins, and a field
+	// with none of them uses its Go name. This eases migrations from
+	// encoding/json: []string{"mapstructure", "json"} reads json tags
+	// (including their ",omitempty" style options) wherever a
+	// mapstructure tag is absent. When empty, TagName alone is used.
+	TagNames []string
+
+	// TypeRegistry maps discriminator values to the concrete types
+	// decoded into interface{} fields. When an interface target's
+	// input map carries the discriminator key (see TypeField), the
+	// registered type is allocated, decoded into and assigned to the
+	// field; an unregistered discriminator is an error listing the
+	// valid values.
+	TypeRegistry map[string]reflect.Type
+
+	// TypeField is the input key holding the discriminator value for
+	// TypeRegistry lookups. It defaults to "type".
+	TypeField string
+
+	// NormalizeKeys, if set, is applied to every string key of the
+	// input before any field matching happens, walking nested maps and
+	// slices of maps recursively. A typical value is strings.ToLower
+	// to make matching case-insensitive at the input level rather than
+	// through MatchName. The input itself is not mutated; a rewritten
+	// copy is decoded instead.
+	NormalizeKeys func(string) string
+
 	// MatchName is the function used to match the map key to the struct
 	// field name or tag. Defaults to `strings.EqualFold`. This can be used
 	// to implement case-sensitive tag values, support snake casing, etc.
+	// CaseInsensitiveMatchName and ExactMatchName are provided as
+	// ready-made comparators.
+	//
+	// When several map keys match the same field, the first match in
+	// lexical key order wins; the order is stable across decodes.
 	MatchName func(mapKey, fieldName string) bool
 }
 
+// CaseInsensitiveMatchName is a MatchName implementation that matches
+// map keys to field names case-insensitively. This is the default.
+func CaseInsensitiveMatchName(mapKey, fieldName string) bool {
+	return strings.EqualFold(mapKey, fieldName)
+}
+
+// ExactMatchName is a MatchName implementation that only matches map
+// keys to field names exactly.
+func ExactMatchName(mapKey, fieldName string) bool {
+	return mapKey == fieldName
+}
+
 // A Decoder takes a raw interface value and turns it into structured
 // data, keeping track of rich error information along the way in case
 // anything goes wrong. Unlike the basic top-level Decode method, you can
@@ -277,17 +518,132 @@ type DecoderConfig struct {
 // up the most basic Decoder.
 type Decoder struct {
 	config *DecoderConfig
+
+	// ctx is the context of the current DecodeContext call, checked
+	// at each step of the recursion; nil for plain Decode calls.
+	ctx context.Context
+
+	// parent is the map the value currently being decoded was read
+	// from, exposed to DecodeHookFuncContext hooks; nil when the
+	// parent container is not a map[string]interface{}.
+	parent map[string]interface{}
+
+	// interned deduplicates decoded string values when
+	// DecoderConfig.InternStrings is set. It lives on the decoder so
+	// reusing one decoder shares storage across Decode calls.
+	interned map[string]string
 }
 
 // Metadata contains information about decoding a structure that
 // is tedious or difficult to get otherwise.
 type Metadata struct {
-	// Keys are the keys of the structure which were successfully decoded
+	// Keys are the keys of the structure which were successfully
+	// decoded, spelled exactly as they appear in the source map even
+	// when a case-insensitive MatchName matched them to a differently
+	// cased field. See FieldPaths for the struct-side spelling.
 	Keys []string
 
+	// FieldPaths mirrors Keys index for index, holding the struct-side
+	// dotted field path (field or tag name) each key decoded into.
+	// Comparing Keys[i] with FieldPaths[i] shows how a
+	// case-insensitive match resolved.
+	FieldPaths []string
+
 	// Unused is a slice of keys that were found in the raw value but
 	// weren't decoded since there was no matching field in the result interface
 	Unused []string
+
+	// Input holds the raw value passed to the top-level Decode call
+	// when DecoderConfig.CaptureInput is set. Maps are reference
+	// types, so this is the same underlying map the caller passed in,
+	// not a copy; mutating it mutates the caller's data.
+	Input interface{}
+
+	// ExplicitNil is a slice of keys whose source value was explicitly
+	// nil, as opposed to absent from the input entirely. It is only
+	// populated when DecoderConfig.DecodeNil is set.
+	ExplicitNil []string
+
+	// Defaulted is a slice of field paths that were populated from a
+	// "default" tag modifier rather than the input. Only fields
+	// decoded with DecoderConfig.ApplyDefaults enabled can appear here.
+	Defaulted []string
+
+	// Types records, per decoded key path, the source and target Go
+	// types involved in the decode. It is only populated when
+	// DecoderConfig.TrackTypes is set, since recording every type pair
+	// has a cost on large inputs.
+	Types map[string]DecodeTypes
+}
+
+// DecodeTypes describes the Go types involved in decoding a single
+// key, as recorded in Metadata.Types.
+type DecodeTypes struct {
+	// Source is the Go type of the input value.
+	Source string
+
+	// Target is the Go type the value was decoded into.
+	Target string
+}
+
+// DecoderOption overrides a single DecoderConfig field on the copy
+// returned by With.
+type DecoderOption func(*DecoderConfig)
+
+// WithTagName sets the struct tag name the decoder reads.
+func WithTagName(name string) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.TagName = name
+	}
+}
+
+// WithWeaklyTypedInput sets the WeaklyTypedInput flag.
+func WithWeaklyTypedInput(weakly bool) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.WeaklyTypedInput = weakly
+	}
+}
+
+// WithSquash sets the Squash flag.
+func WithSquash(squash bool) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.Squash = squash
+	}
+}
+
+// WithDecodeHook sets the decode hook. Use ComposeDecodeHookFunc to
+// install more than one.
+func WithDecodeHook(hook DecodeHookFunc) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.DecodeHook = hook
+	}
+}
+
+// WithMetadata sets the metadata collection target.
+func WithMetadata(metadata *Metadata) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.Metadata = metadata
+	}
+}
+
+// WithResult sets the decode target. It must be a pointer.
+func WithResult(result interface{}) DecoderOption {
+	return func(config *DecoderConfig) {
+		config.Result = result
+	}
+}
+
+// With returns a copy of the config with the given options applied. The
+// receiver is left untouched, so a library can keep one shared base
+// configuration and hand out per-call variants without callers mutating
+// it. Pointer-valued fields such as Metadata and Result are shared with
+// the copy; set fresh ones on the returned config if that matters.
+func (c *DecoderConfig) With(opts ...DecoderOption) *DecoderConfig {
+	config := *c
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &config
 }
 
 // Decode takes an input structure and uses reflection to translate it to
@@ -357,53 +713,260 @@ func WeakDecodeMetadata(input interface{}, output interface{}, metadata *Metadat
 	return decoder.Decode(input)
 }
 
+// DecodeAs is a generic shorthand for Decode that allocates, decodes
+// and returns the typed result, avoiding the declare-then-pass-pointer
+// dance at call sites:
+//
+//	cfg, err := mapstructure.DecodeAs[Config](input)
+//
+// T may itself be a pointer type. On error the zero value of T is
+// returned.
+func DecodeAs[T any](input interface{}) (T, error) {
+	return DecodeAsWithConfig[T](input, &DecoderConfig{})
+}
+
+// DecodeAsWithConfig is DecodeAs with a caller-supplied DecoderConfig.
+// The configuration's Result field is overwritten with the allocated
+// target.
+func DecodeAsWithConfig[T any](input interface{}, config *DecoderConfig) (T, error) {
+	var result T
+
+	config.Result = &result
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		return result, err
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return result, nil
+}
+
 // NewDecoder returns a new decoder for the given configuration. Once
 // a decoder has been returned, the same configuration must not be used
 // again.
+//
+// A Decoder may be reused for many Decode calls, but is not safe for
+// concurrent use; use one Decoder per goroutine or guard it with a
+// mutex. See Reset for reuse in allocation-sensitive loops.
 func NewDecoder(config *DecoderConfig) (*Decoder, error) {
+	result := &Decoder{}
+	if err := result.Reset(config); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NewDecoderWith builds a DecoderConfig from functional options and
+// returns a decoder for it, avoiding the struct-literal dance:
+//
+//	decoder, err := mapstructure.NewDecoderWith(
+//		mapstructure.WithResult(&config),
+//		mapstructure.WithWeaklyTypedInput(true),
+//	)
+//
+// WithResult is required; without it the usual "result must be a
+// pointer" error is returned.
+func NewDecoderWith(opts ...DecoderOption) (*Decoder, error) {
+	config := &DecoderConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return NewDecoder(config)
+}
+
+// Reset reconfigures the decoder in place so a single Decoder can be
+// reused across many Decode calls without allocating a fresh one each
+// iteration. Any Metadata attached to the configuration has its
+// accumulated Keys, Unused and related state cleared. Passing the
+// decoder's current configuration is allowed and simply resets the
+// metadata.
+func (d *Decoder) Reset(config *DecoderConfig) error {
 	val := reflect.ValueOf(config.Result)
 	if val.Kind() != reflect.Ptr {
-		return nil, errors.New("result must be a pointer")
+		return errors.New("result must be a pointer")
 	}
 
 	val = val.Elem()
 	if !val.CanAddr() {
-		return nil, errors.New("result must be addressable (a pointer)")
+		return errors.New("result must be addressable (a pointer)")
 	}
 
 	if config.Metadata != nil {
-		if config.Metadata.Keys == nil {
-			config.Metadata.Keys = make([]string, 0)
-		}
-
-		if config.Metadata.Unused == nil {
-			config.Metadata.Unused = make([]string, 0)
-		}
+		config.Metadata.Keys = make([]string, 0)
+		config.Metadata.FieldPaths = make([]string, 0)
+		config.Metadata.Unused = make([]string, 0)
+		config.Metadata.ExplicitNil = nil
+		config.Metadata.Defaulted = nil
+		config.Metadata.Types = nil
+		config.Metadata.Input = nil
 	}
 
 	if config.TagName == "" {
 		config.TagName = "mapstructure"
 	}
 
+	if len(config.TagNames) == 0 {
+		config.TagNames = []string{config.TagName}
+	}
+
 	if config.MatchName == nil {
 		config.MatchName = strings.EqualFold
 	}
 
-	result := &Decoder{
-		config: config,
+	d.config = config
+	d.interned = nil
+	return nil
+}
+
+// fieldTag returns the naming tag value for a struct field,
+// consulting the configured TagNames in order and returning the first
+// tag that is present, even if its value is empty.
+func (d *Decoder) fieldTag(tag reflect.StructTag) string {
+	value, _ := d.fieldTagLookup(tag)
+	return value
+}
+
+// fieldTagLookup is fieldTag but also reports whether any of the
+// configured tag names was present.
+func (d *Decoder) fieldTagLookup(tag reflect.StructTag) (string, bool) {
+	for _, name := range d.config.TagNames {
+		if value, ok := tag.Lookup(name); ok {
+			return value, true
+		}
 	}
 
-	return result, nil
+	return "", false
 }
 
 // Decode decodes the given raw interface to the target pointer specified
 // by the configuration.
 func (d *Decoder) Decode(input interface{}) error {
+	// Capture before the NormalizeKeys rewrite so audit flows see the
+	// raw source, as the Metadata.Input doc promises.
+	if d.config.CaptureInput && d.config.Metadata != nil {
+		d.config.Metadata.Input = input
+	}
+
+	if d.config.NormalizeKeys != nil {
+		input = normalizeKeys(input, d.config.NormalizeKeys)
+	}
+
 	return d.decode("", input, reflect.ValueOf(d.config.Result).Elem())
 }
 
+// FieldAction describes one field a Decode call would touch, as
+// reported by Plan.
+type FieldAction struct {
+	// Path is the dotted field path, as it appears in Metadata.Keys.
+	Path string
+
+	// FromType is the Go type of the input value.
+	FromType string
+
+	// ToType is the Go type of the target field.
+	ToType string
+
+	// WouldSet is true when Decode would write the field; false for
+	// input keys with no matching field, which are only reported.
+	WouldSet bool
+}
+
+// Plan reports which fields a Decode of the given input would set,
+// without mutating the configured Result. The decode logic runs
+// against a throwaway zero value of the target type, so the returned
+// actions reflect type conversions and key matching exactly; merge
+// effects that depend on pre-existing target data are not modeled.
+// This supports diff/preview UIs that show pending changes before
+// applying them.
+func (d *Decoder) Plan(input interface{}) ([]FieldAction, error) {
+	resultVal := reflect.ValueOf(d.config.Result).Elem()
+	scratch := reflect.New(resultVal.Type())
+
+	config := *d.config
+	config.Metadata = new(Metadata)
+	config.TrackTypes = true
+	config.Result = scratch.Interface()
+
+	planner := new(Decoder)
+	if err := planner.Reset(&config); err != nil {
+		return nil, err
+	}
+
+	err := planner.Decode(input)
+
+	md := config.Metadata
+	actions := make([]FieldAction, 0, len(md.Keys)+len(md.Unused))
+	for _, key := range md.Keys {
+		action := FieldAction{Path: key, WouldSet: true}
+		if types, ok := md.Types[key]; ok {
+			action.FromType = types.Source
+			action.ToType = types.Target
+		}
+		actions = append(actions, action)
+	}
+	for _, key := range md.Unused {
+		actions = append(actions, FieldAction{Path: key})
+	}
+
+	return actions, err
+}
+
+// DecodeContext is like Decode but aborts promptly with ctx.Err()
+// when the context is cancelled, checking it as the recursion enters
+// each value. This keeps decoding of very large documents responsive
+// to request cancellation; Decode itself stays context-free.
+func (d *Decoder) DecodeContext(ctx context.Context, input interface{}) error {
+	d.ctx = ctx
+	defer func() { d.ctx = nil }()
+
+	return d.Decode(input)
+}
+
+// normalizeKeys returns a copy of the input with fn applied to every
+// string map key, recursing through nested maps and slices so deeply
+// nested keys are rewritten too.
+func normalizeKeys(input interface{}, fn func(string) string) interface{} {
+	switch v := input.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			result[fn(k)] = normalizeKeys(val, fn)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(v))
+		for k, val := range v {
+			if s, ok := k.(string); ok {
+				result[fn(s)] = normalizeKeys(val, fn)
+			} else {
+				result[k] = normalizeKeys(val, fn)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = normalizeKeys(val, fn)
+		}
+		return result
+	default:
+		return input
+	}
+}
+
 // Decodes an unknown data type into a specific reflection value.
 func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) error {
+	if d.ctx != nil {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+	}
+
 	var inputVal reflect.Value
 	if input != nil {
 		inputVal = reflect.ValueOf(input)
@@ -416,13 +979,18 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 	}
 
 	if input == nil {
+		if d.config.DecodeNil && d.config.Metadata != nil && name != "" {
+			d.config.Metadata.ExplicitNil = append(
+				d.config.Metadata.ExplicitNil, name)
+		}
+
 		// If the data is nil, then we don't set anything, unless ZeroFields is set
 		// to true.
 		if d.config.ZeroFields {
 			outVal.Set(reflect.Zero(outVal.Type()))
 
 			if d.config.Metadata != nil && name != "" {
-				d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
+				d.addMetaKey(name)
 			}
 		}
 		return nil
@@ -433,15 +1001,31 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 		// to be the zero value.
 		outVal.Set(reflect.Zero(outVal.Type()))
 		if d.config.Metadata != nil && name != "" {
-			d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
+			d.addMetaKey(name)
 		}
 		return nil
 	}
 
-	if d.config.DecodeHook != nil {
+	if d.config.EmptyStringAsZero {
+		if str, ok := input.(string); ok && str == "" {
+			switch getKind(outVal) {
+			case reflect.Bool, reflect.Int, reflect.Uint, reflect.Float32:
+				outVal.Set(reflect.Zero(outVal.Type()))
+				if d.config.Metadata != nil && name != "" {
+					d.addMetaKey(name)
+				}
+				return nil
+			}
+		}
+	}
+
+	if d.config.DecodeHook != nil && !d.config.DecodeHookRunsAfterBuiltin {
 		// We have a DecodeHook, so let's pre-process the input.
+		ctx := hookContextFromName(name)
+		ctx.Parent = d.parent
+
 		var err error
-		input, err = DecodeHookExec(d.config.DecodeHook, name, inputVal, outVal)
+		input, err = decodeHookExecContext(d.config.DecodeHook, ctx, inputVal, outVal)
 		if err != nil {
 			return fmt.Errorf("error decoding '%s': %s", name, err)
 		}
@@ -475,23 +1059,149 @@ func (d *Decoder) decode(name string, input interface{}, outVal reflect.Value) e
 		err = d.decodeArray(name, input, outVal)
 	case reflect.Func:
 		err = d.decodeFunc(name, input, outVal)
+	case reflect.Chan, reflect.UnsafePointer:
+		// These kinds cannot be produced from plain data. Skip them
+		// silently unless the config asks for a descriptive error.
+		if d.config.ErrorUnsupportedKinds {
+			return fmt.Errorf("%s: unsupported kind: %s", name, outputKind)
+		}
+		addMetaKey = false
 	default:
 		// If we reached this point then we weren't able to decode it
 		return fmt.Errorf("%s: unsupported type: %s", name, outputKind)
 	}
 
+	// In fallback mode the hook only runs once the built-in conversion
+	// has failed, and its output gets one more conversion attempt. The
+	// equality guard stops hooks that merely pass data through from
+	// retrying forever.
+	if err != nil && d.config.DecodeHookRunsAfterBuiltin && d.config.DecodeHook != nil {
+		ctx := hookContextFromName(name)
+		ctx.Parent = d.parent
+
+		transformed, hookErr := decodeHookExecContext(d.config.DecodeHook, ctx, inputVal, outVal)
+		if hookErr != nil {
+			return fmt.Errorf("error decoding '%s': %s", name, hookErr)
+		}
+		if !reflect.DeepEqual(transformed, input) {
+			err = d.decode(name, transformed, outVal)
+			// The retry records the key itself; don't append it twice.
+			addMetaKey = false
+		}
+	}
+
+	// Run inline validation on the freshly set value. The error keeps
+	// the field path so callers can locate the offending value.
+	if err == nil && name != "" && d.config.PostFieldHook != nil {
+		if hookErr := d.config.PostFieldHook(name, outVal); hookErr != nil {
+			err = fmt.Errorf("error validating '%s': %s", name, hookErr)
+		}
+	}
+
 	// If we reached here, then we successfully decoded SOMETHING, so
 	// mark the key as used if we're tracking metainput.
 	if addMetaKey && d.config.Metadata != nil && name != "" {
-		d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
+		d.addMetaKey(name)
+
+		if d.config.TrackTypes && err == nil {
+			if d.config.Metadata.Types == nil {
+				d.config.Metadata.Types = make(map[string]DecodeTypes)
+			}
+			d.config.Metadata.Types[name] = DecodeTypes{
+				Source: inputVal.Type().String(),
+				Target: outVal.Type().String(),
+			}
+		}
 	}
 
 	return err
 }
 
+// addMetaKey records a successfully decoded key in the metadata. Keys
+// and FieldPaths start out identical; decodeStructFromMap rewrites the
+// Keys entries to the source map's exact spelling afterwards.
+func (d *Decoder) addMetaKey(name string) {
+	d.config.Metadata.Keys = append(d.config.Metadata.Keys, name)
+	d.config.Metadata.FieldPaths = append(d.config.Metadata.FieldPaths, name)
+}
+
+// rewriteMetaKeys rewrites the Metadata.Keys entries appended from
+// index start on, replacing the fieldPath prefix with sourcePath, and
+// moves any Metadata.Types entries along to the rewritten key.
+// FieldPaths is left alone so it keeps the struct-side spelling.
+func (d *Decoder) rewriteMetaKeys(start int, fieldPath, sourcePath string) {
+	md := d.config.Metadata
+	for i := start; i < len(md.Keys); i++ {
+		if !strings.HasPrefix(md.Keys[i], fieldPath) {
+			continue
+		}
+
+		rewritten := sourcePath + md.Keys[i][len(fieldPath):]
+		if types, ok := md.Types[md.Keys[i]]; ok {
+			delete(md.Types, md.Keys[i])
+			md.Types[rewritten] = types
+		}
+		md.Keys[i] = rewritten
+	}
+}
+
 // This decodes a basic type (bool, int, string, etc.) and sets the
 // value to "data" of that type.
 func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value) error {
+	// Polymorphic decoding: an interface target whose input carries a
+	// discriminator key is decoded into the registered concrete type.
+	if len(d.config.TypeRegistry) > 0 &&
+		val.Kind() == reflect.Interface && val.IsNil() {
+		if m, ok := data.(map[string]interface{}); ok {
+			typeField := d.config.TypeField
+			if typeField == "" {
+				typeField = "type"
+			}
+
+			if disc, ok := m[typeField].(string); ok {
+				concrete, ok := d.config.TypeRegistry[disc]
+				if !ok {
+					valid := make([]string, 0, len(d.config.TypeRegistry))
+					for k := range d.config.TypeRegistry {
+						valid = append(valid, k)
+					}
+					sort.Strings(valid)
+					return fmt.Errorf(
+						"'%s' unknown type %q, valid types are: %s",
+						name, disc, strings.Join(valid, ", "))
+				}
+
+				ptr := reflect.New(concrete)
+				if err := d.decode(name, data, ptr.Elem()); err != nil {
+					return err
+				}
+
+				val.Set(ptr.Elem())
+				return nil
+			}
+		}
+	}
+
+	// Preserve numeric precision for interface{} targets: large
+	// integers survive as json.Number instead of rounding through
+	// float64, mirroring json.Decoder.UseNumber.
+	if d.config.UseNumber && val.Kind() == reflect.Interface {
+		switch v := data.(type) {
+		case json.Number:
+			// Already preserved.
+		case float64:
+			data = json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+		case float32:
+			data = json.Number(strconv.FormatFloat(float64(v), 'f', -1, 32))
+		case int:
+			data = json.Number(strconv.FormatInt(int64(v), 10))
+		case int64:
+			data = json.Number(strconv.FormatInt(v, 10))
+		case uint64:
+			data = json.Number(strconv.FormatUint(v, 10))
+		}
+	}
+
 	if val.IsValid() && val.Elem().IsValid() {
 		elem := val.Elem()
 
@@ -538,6 +1248,9 @@ func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value)
 
 	dataValType := dataVal.Type()
 	if !dataValType.AssignableTo(val.Type()) {
+		if d.config.ErrorFormatter != nil {
+			return d.config.ErrorFormatter(name, val.Type(), dataValType)
+		}
 		return fmt.Errorf(
 			"'%s' expected type '%s', got '%s'",
 			name, val.Type(), dataValType)
@@ -547,6 +1260,39 @@ func (d *Decoder) decodeBasic(name string, data interface{}, val reflect.Value)
 	return nil
 }
 
+// typeMismatchError builds the error for a value that cannot be
+// converted to the target type, deferring to the configured
+// ErrorFormatter when one is set.
+func (d *Decoder) typeMismatchError(name string, expected, actual reflect.Type, value interface{}) error {
+	if d.config.ErrorFormatter != nil {
+		return d.config.ErrorFormatter(name, expected, actual)
+	}
+	return &DecodeError{
+		Path:     name,
+		Expected: expected,
+		Actual:   actual,
+		Value:    value,
+	}
+}
+
+// internString returns a canonical copy of s when InternStrings is
+// enabled, so repeated values share backing storage.
+func (d *Decoder) internString(s string) string {
+	if !d.config.InternStrings {
+		return s
+	}
+
+	if interned, ok := d.interned[s]; ok {
+		return interned
+	}
+
+	if d.interned == nil {
+		d.interned = make(map[string]string)
+	}
+	d.interned[s] = s
+	return s
+}
+
 func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value) error {
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	dataKind := getKind(dataVal)
@@ -554,7 +1300,7 @@ func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value)
 	converted := true
 	switch {
 	case dataKind == reflect.String:
-		val.SetString(dataVal.String())
+		val.SetString(d.internString(dataVal.String()))
 	case dataKind == reflect.Bool && d.config.WeaklyTypedInput:
 		if dataVal.Bool() {
 			val.SetString("1")
@@ -591,9 +1337,7 @@ func (d *Decoder) decodeString(name string, data interface{}, val reflect.Value)
 	}
 
 	if !converted {
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
 	}
 
 	return nil
@@ -638,9 +1382,7 @@ func (d *Decoder) decodeInt(name string, data interface{}, val reflect.Value) er
 		}
 		val.SetInt(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
 	}
 
 	return nil
@@ -695,9 +1437,7 @@ func (d *Decoder) decodeUint(name string, data interface{}, val reflect.Value) e
 		}
 		val.SetUint(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
 	}
 
 	return nil
@@ -726,9 +1466,7 @@ func (d *Decoder) decodeBool(name string, data interface{}, val reflect.Value) e
 			return fmt.Errorf("cannot parse '%s' as bool: %s", name, err)
 		}
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
 	}
 
 	return nil
@@ -773,9 +1511,7 @@ func (d *Decoder) decodeFloat(name string, data interface{}, val reflect.Value)
 		}
 		val.SetFloat(i)
 	default:
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
 	}
 
 	return nil
@@ -841,13 +1577,21 @@ func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val refle
 	valKeyType := valType.Key()
 	valElemType := valType.Elem()
 
+	// Expose the map being decoded to context-aware hooks, as
+	// decodeStructFromMap does.
+	prevParent := d.parent
+	d.parent, _ = dataVal.Interface().(map[string]interface{})
+	defer func() { d.parent = prevParent }()
+
 	// Accumulate errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	// If the input data is empty, then we just match what the input data is.
 	if dataVal.Len() == 0 {
 		if dataVal.IsNil() {
-			if !val.IsNil() {
+			if d.config.PreserveEmptyCollections {
+				val.Set(valMap)
+			} else if !val.IsNil() {
 				val.Set(dataVal)
 			}
 		} else {
@@ -863,16 +1607,32 @@ func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val refle
 
 		// First decode the key into the proper type
 		currentKey := reflect.Indirect(reflect.New(valKeyType))
-		if err := d.decode(fieldName, k.Interface(), currentKey); err != nil {
+		if err := d.decodeMapKey(fieldName, k, currentKey); err != nil {
 			errors = appendErrors(errors, err)
+			if d.config.StopOnError {
+				break
+			}
 			continue
 		}
 
 		// Next decode the data into the proper type
 		v := dataVal.MapIndex(k).Interface()
 		currentVal := reflect.Indirect(reflect.New(valElemType))
+
+		// With MergeMaps, seed the target with any existing value for
+		// this key so nested maps merge recursively instead of being
+		// replaced wholesale.
+		if d.config.MergeMaps {
+			if existing := valMap.MapIndex(currentKey); existing.IsValid() {
+				currentVal.Set(existing)
+			}
+		}
+
 		if err := d.decode(fieldName, v, currentVal); err != nil {
 			errors = appendErrors(errors, err)
+			if d.config.StopOnError {
+				break
+			}
 			continue
 		}
 
@@ -884,12 +1644,34 @@ func (d *Decoder) decodeMapFromMap(name string, dataVal reflect.Value, val refle
 
 	// If we had errors, return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
 }
 
+// decodeMapKey decodes a single map key. When the target key type
+// implements encoding.TextUnmarshaler, string source keys are
+// unmarshalled through it, mirroring how encoding/json treats
+// TextMarshaler map keys. All other keys take the normal decode path.
+func (d *Decoder) decodeMapKey(name string, data reflect.Value, val reflect.Value) error {
+	key := data
+	if key.Kind() == reflect.Interface {
+		key = key.Elem()
+	}
+
+	if key.Kind() == reflect.String {
+		if u, ok := val.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(key.String())); err != nil {
+				return fmt.Errorf("error decoding '%s' map key: %s", name, err)
+			}
+			return nil
+		}
+	}
+
+	return d.decode(name, data.Interface(), val)
+}
+
 func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val reflect.Value, valMap reflect.Value) error {
 	typ := dataVal.Type()
 	for i := 0; i < typ.NumField(); i++ {
@@ -907,7 +1689,7 @@ func (d *Decoder) decodeMapFromStruct(name string, dataVal reflect.Value, val re
 			return fmt.Errorf("cannot assign type '%s' to map value field of type '%s'", v.Type(), valMap.Type().Elem())
 		}
 
-		tagValue := f.Tag.Get(d.config.TagName)
+		tagValue := d.fieldTag(f.Tag)
 		keyName := f.Name
 
 		// If Squash is set in the config, we squash the field down.
@@ -1044,9 +1826,12 @@ func (d *Decoder) decodeFunc(name string, data interface{}, val reflect.Value) e
 	// into that. Then set the value of the pointer to this type.
 	dataVal := reflect.Indirect(reflect.ValueOf(data))
 	if val.Type() != dataVal.Type() {
-		return fmt.Errorf(
-			"'%s' expected type '%s', got unconvertible type '%s', value: '%v'",
-			name, val.Type(), dataVal.Type(), data)
+		// Anything but an identically typed func cannot fill a func
+		// field; skip it unless the config asks for an error.
+		if d.config.ErrorUnsupportedKinds {
+			return d.typeMismatchError(name, val.Type(), dataVal.Type(), data)
+		}
+		return nil
 	}
 	val.Set(dataVal)
 	return nil
@@ -1092,29 +1877,47 @@ func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value)
 	}
 
 	// If the input value is nil, then don't allocate since empty != nil
-	if dataVal.IsNil() {
+	if dataValKind == reflect.Slice && dataVal.IsNil() {
+		if d.config.PreserveEmptyCollections && val.CanSet() && val.IsNil() {
+			val.Set(reflect.MakeSlice(sliceType, 0, 0))
+		}
 		return nil
 	}
 
 	valSlice := val
-	if valSlice.IsNil() || d.config.ZeroFields {
-		// Make a new slice to hold our result, same size as the original data.
-		valSlice = reflect.MakeSlice(sliceType, dataVal.Len(), dataVal.Len())
+	start := 0
+	switch d.config.SliceMergeMode {
+	case SliceMergeAppend:
+		// Source elements land after any existing ones.
+		start = valSlice.Len()
+	case SliceMergeByIndex:
+		// Source elements are decoded into the existing elements at
+		// matching indices; nothing extra to set up, the loop below
+		// grows the slice when the source is longer.
+	default: // SliceMergeReplace
+		if valSlice.IsNil() || d.config.ZeroFields {
+			// Make a new slice to hold our result, same size as the original data.
+			valSlice = reflect.MakeSlice(sliceType, dataVal.Len(), dataVal.Len())
+		}
 	}
 
 	// Accumulate any errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	for i := 0; i < dataVal.Len(); i++ {
 		currentData := dataVal.Index(i).Interface()
-		for valSlice.Len() <= i {
+		idx := start + i
+		for valSlice.Len() <= idx {
 			valSlice = reflect.Append(valSlice, reflect.Zero(valElemType))
 		}
-		currentField := valSlice.Index(i)
+		currentField := valSlice.Index(idx)
 
-		fieldName := name + "[" + strconv.Itoa(i) + "]"
+		fieldName := name + "[" + strconv.Itoa(idx) + "]"
 		if err := d.decode(fieldName, currentData, currentField); err != nil {
 			errors = appendErrors(errors, err)
+			if d.config.StopOnError {
+				break
+			}
 		}
 	}
 
@@ -1123,7 +1926,7 @@ func (d *Decoder) decodeSlice(name string, data interface{}, val reflect.Value)
 
 	// If there were errors, we return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
@@ -1173,7 +1976,7 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 	}
 
 	// Accumulate any errors
-	errors := make([]string, 0)
+	errors := make([]error, 0)
 
 	for i := 0; i < dataVal.Len(); i++ {
 		currentData := dataVal.Index(i).Interface()
@@ -1182,6 +1985,9 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 		fieldName := name + "[" + strconv.Itoa(i) + "]"
 		if err := d.decode(fieldName, currentData, currentField); err != nil {
 			errors = appendErrors(errors, err)
+			if d.config.StopOnError {
+				break
+			}
 		}
 	}
 
@@ -1190,7 +1996,7 @@ func (d *Decoder) decodeArray(name string, data interface{}, val reflect.Value)
 
 	// If there were errors, we return those
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	return nil
@@ -1239,6 +2045,123 @@ func (d *Decoder) decodeStruct(name string, data interface{}, val reflect.Value)
 	}
 }
 
+// typeSquashed reports whether the given type is registered in
+// DecoderConfig.SquashTypes, comparing pointer types and their
+// elements interchangeably.
+func (d *Decoder) typeSquashed(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, st := range d.config.SquashTypes {
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		if st == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldTagInfo is the cached, parsed form of a struct field's naming
+// tag: the name portion before the first comma and any option
+// modifiers after it.
+type fieldTagInfo struct {
+	name    string
+	options []string
+
+	// tagged records whether any of the configured tag names was
+	// present at all, which IgnoreUntaggedFields needs to distinguish
+	// an absent tag from an empty one.
+	tagged bool
+}
+
+// fieldCacheKey keys the parsed-tag cache on both the struct type and
+// the tag name list, so decoders configured with a different TagName
+// or TagNames never see each other's entries.
+type fieldCacheKey struct {
+	typ  reflect.Type
+	tags string
+}
+
+// fieldTagCache caches parsed field tags per struct type. Re-parsing
+// tags on every decode shows up in profiles of hot loops; the cache
+// is shared by all decoders and safe for concurrent use.
+var fieldTagCache sync.Map // fieldCacheKey -> []fieldTagInfo
+
+// structFieldTags returns the parsed naming tags for every field of
+// the given struct type, computing and caching them on first use.
+func (d *Decoder) structFieldTags(typ reflect.Type) []fieldTagInfo {
+	key := fieldCacheKey{typ: typ, tags: strings.Join(d.config.TagNames, ",")}
+	if cached, ok := fieldTagCache.Load(key); ok {
+		return cached.([]fieldTagInfo)
+	}
+
+	infos := make([]fieldTagInfo, typ.NumField())
+	for i := range infos {
+		value, tagged := d.fieldTagLookup(typ.Field(i).Tag)
+		parts := strings.Split(value, ",")
+		infos[i] = fieldTagInfo{name: parts[0], options: parts[1:], tagged: tagged}
+	}
+
+	cached, _ := fieldTagCache.LoadOrStore(key, infos)
+	return cached.([]fieldTagInfo)
+}
+
+// structHasMatchingKeys reports whether the input map holds a key for
+// any field of the given struct type, following squashed embeds. It
+// decides whether a nil embedded struct pointer needs allocating
+// before a squash.
+func (d *Decoder) structHasMatchingKeys(typ reflect.Type, dataVal reflect.Value) bool {
+	tagInfos := d.structFieldTags(typ)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		fieldName := f.Name
+		tagInfo := tagInfos[i]
+		if tagInfo.name == "-" {
+			continue
+		}
+		if tagInfo.name != "" {
+			fieldName = tagInfo.name
+		}
+
+		fieldType := f.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		squash := (d.config.Squash || d.typeSquashed(f.Type)) && f.Anonymous && fieldType.Kind() == reflect.Struct
+		for _, tag := range tagInfo.options {
+			if tag == "squash" {
+				squash = true
+				break
+			}
+		}
+		if squash && fieldType.Kind() == reflect.Struct {
+			if d.structHasMatchingKeys(fieldType, dataVal) {
+				return true
+			}
+			continue
+		}
+
+		for _, dataValKey := range dataVal.MapKeys() {
+			mK, ok := dataValKey.Interface().(string)
+			if !ok {
+				continue
+			}
+
+			if d.config.MatchName(mK, fieldName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) error {
 	dataValType := dataVal.Type()
 	if kind := dataValType.Key().Kind(); kind != reflect.String && kind != reflect.Interface {
@@ -1247,14 +2170,41 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 			name, dataValType.Key().Kind())
 	}
 
-	dataValKeys := make(map[reflect.Value]struct{})
+	// Expose the map being decoded to context-aware hooks so field
+	// conversions can inspect sibling keys. Restore the previous
+	// parent afterwards since nested decodes overwrite it.
+	prevParent := d.parent
+	d.parent, _ = dataVal.Interface().(map[string]interface{})
+	defer func() { d.parent = prevParent }()
+
+	dataValKeys := make([]reflect.Value, 0, dataVal.Len())
 	dataValKeysUnused := make(map[interface{}]struct{})
 	for _, dataValKey := range dataVal.MapKeys() {
-		dataValKeys[dataValKey] = struct{}{}
+		dataValKeys = append(dataValKeys, dataValKey)
 		dataValKeysUnused[dataValKey.Interface()] = struct{}{}
 	}
 
-	errors := make([]string, 0)
+	// Sort the keys so that when MatchName matches several map keys to
+	// one field, the first match in lexical key order wins and the
+	// result is stable across decodes.
+	sort.Slice(dataValKeys, func(i, j int) bool {
+		iK, iOk := dataValKeys[i].Interface().(string)
+		jK, jOk := dataValKeys[j].Interface().(string)
+		if !iOk || !jOk {
+			return iOk
+		}
+		return iK < jK
+	})
+
+	errors := make([]error, 0)
+
+	// missingRequired collects the paths of all "required"-tagged
+	// fields without a matching key so they can be reported together.
+	var missingRequired []string
+
+	// unsetFields collects the paths of all fields that never received
+	// a value, for ErrorUnset.
+	var unsetFields []string
 
 	// This slice will keep track of all the structs we'll be decoding.
 	// There can be more than one struct if there are embedded structs
@@ -1267,6 +2217,11 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 	type field struct {
 		field reflect.StructField
 		val   reflect.Value
+		tag   fieldTagInfo
+
+		// owner is the struct type the field was declared on, so
+		// FieldHooks can target a field of one specific type.
+		owner reflect.Type
 	}
 
 	// remainField is set to a valid field set with the "remain" tag if
@@ -1279,22 +2234,31 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 		structs = structs[1:]
 
 		structType := structVal.Type()
+		tagInfos := d.structFieldTags(structType)
 
 		for i := 0; i < structType.NumField(); i++ {
 			fieldType := structType.Field(i)
 			fieldVal := structVal.Field(i)
-			if fieldVal.Kind() == reflect.Ptr && fieldVal.Elem().Kind() == reflect.Struct {
+			tagInfo := tagInfos[i]
+			if d.config.IgnoreUntaggedFields && !tagInfo.tagged {
+				continue
+			}
+			if fieldVal.Kind() == reflect.Ptr && fieldVal.Elem().Kind() == reflect.Struct &&
+				!d.config.ZeroFields {
 				// Handle embedded struct pointers as embedded structs.
+				// With ZeroFields the pointer is left alone so that
+				// decodePtr allocates a fresh pointee instead of
+				// merging into the existing one.
 				fieldVal = fieldVal.Elem()
 			}
 
 			// If "squash" is specified in the tag, we squash the field down.
-			squash := d.config.Squash && fieldVal.Kind() == reflect.Struct && fieldType.Anonymous
+			squash := (d.config.Squash || d.typeSquashed(fieldType.Type)) && fieldType.Anonymous &&
+				(fieldVal.Kind() == reflect.Struct ||
+					(fieldVal.Kind() == reflect.Ptr && fieldVal.Type().Elem().Kind() == reflect.Struct))
 			remain := false
 
-			// We always parse the tags cause we're looking for other tags too
-			tagParts := strings.Split(fieldType.Tag.Get(d.config.TagName), ",")
-			for _, tag := range tagParts[1:] {
+			for _, tag := range tagInfo.options {
 				if tag == "squash" {
 					squash = true
 					break
@@ -1306,7 +2270,31 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 				}
 			}
 
+			// A nil embedded struct pointer is allocated before
+			// squashing, but only when the input holds at least one of
+			// its keys; otherwise the pointer is left nil.
+			if squash && fieldVal.Kind() == reflect.Ptr && fieldVal.IsNil() &&
+				fieldVal.Type().Elem().Kind() == reflect.Struct {
+				if !fieldVal.CanSet() || !d.structHasMatchingKeys(fieldVal.Type().Elem(), dataVal) {
+					continue
+				}
+
+				fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
+				fieldVal = fieldVal.Elem()
+			}
+
 			if squash {
+				// A non-nil embedded struct pointer reaches here with
+				// ZeroFields, which skips the deref above. Zero the
+				// pointee, then squash into it.
+				if fieldVal.Kind() == reflect.Ptr && !fieldVal.IsNil() &&
+					fieldVal.Type().Elem().Kind() == reflect.Struct {
+					if fieldVal.CanSet() {
+						fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
+					}
+					fieldVal = fieldVal.Elem()
+				}
+
 				if fieldVal.Kind() != reflect.Struct {
 					errors = appendErrors(errors,
 						fmt.Errorf("%s: unsupported type for squash: %s", fieldType.Name, fieldVal.Kind()))
@@ -1318,10 +2306,10 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 
 			// Build our field
 			if remain {
-				remainField = &field{fieldType, fieldVal}
+				remainField = &field{fieldType, fieldVal, tagInfo, structType}
 			} else {
 				// Normal struct field, store it away
-				fields = append(fields, field{fieldType, fieldVal})
+				fields = append(fields, field{fieldType, fieldVal, tagInfo, structType})
 			}
 		}
 	}
@@ -1331,18 +2319,32 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 		field, fieldValue := f.field, f.val
 		fieldName := field.Name
 
-		tagValue := field.Tag.Get(d.config.TagName)
-		tagValue = strings.SplitN(tagValue, ",", 2)[0]
-		if tagValue != "" {
-			fieldName = tagValue
+		if f.tag.name != "" {
+			fieldName = f.tag.name
+		}
+
+		// Look for "default=..." and "required" tag modifiers if the
+		// respective options are enabled.
+		defaultVal := ""
+		hasDefault := false
+		required := false
+		for _, tag := range f.tag.options {
+			if d.config.ApplyDefaults && strings.HasPrefix(tag, "default=") {
+				defaultVal = strings.TrimPrefix(tag, "default=")
+				hasDefault = true
+			}
+
+			if d.config.ErrorOnMissingRequired && tag == "required" {
+				required = true
+			}
 		}
 
 		rawMapKey := reflect.ValueOf(fieldName)
 		rawMapVal := dataVal.MapIndex(rawMapKey)
 		if !rawMapVal.IsValid() {
-			// Do a slower search by iterating over each key and
-			// doing case-insensitive search.
-			for dataValKey := range dataValKeys {
+			// Do a slower search by iterating over each key in sorted
+			// order and matching with the configured MatchName.
+			for _, dataValKey := range dataValKeys {
 				mK, ok := dataValKey.Interface().(string)
 				if !ok {
 					// Not a string key
@@ -1357,6 +2359,47 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 			}
 
 			if !rawMapVal.IsValid() {
+				if hasDefault && fieldValue.CanSet() {
+					defaultName := fieldName
+					if name != "" {
+						defaultName = name + "." + defaultName
+					}
+
+					// The default expression is always a string, so decode
+					// it weakly so that "8080" can fill an int field. The
+					// configured DecodeHook still runs first.
+					weak := d.config.WeaklyTypedInput
+					d.config.WeaklyTypedInput = true
+					err := d.decode(defaultName, defaultVal, fieldValue)
+					d.config.WeaklyTypedInput = weak
+					if err != nil {
+						errors = appendErrors(errors, err)
+					} else if d.config.Metadata != nil {
+						d.config.Metadata.Defaulted = append(
+							d.config.Metadata.Defaulted, defaultName)
+					}
+				}
+
+				// A field whose default was just applied is not
+				// missing, so default= and required compose.
+				if required && !hasDefault {
+					missingName := fieldName
+					if name != "" {
+						missingName = name + "." + missingName
+					}
+					missingRequired = append(missingRequired, missingName)
+					continue
+				}
+
+				if d.config.ErrorUnset && !hasDefault &&
+					f.tag.name != "-" && fieldValue.CanSet() {
+					unsetName := fieldName
+					if name != "" {
+						unsetName = name + "." + unsetName
+					}
+					unsetFields = append(unsetFields, unsetName)
+				}
+
 				// There was no matching key in the map for the value in
 				// the struct. Just ignore.
 				continue
@@ -1383,11 +2426,76 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 			fieldName = name + "." + fieldName
 		}
 
-		if err := d.decode(fieldName, rawMapVal.Interface(), fieldValue); err != nil {
+		// Remember how many keys were recorded so far, so the entries
+		// appended while decoding this field can be rewritten to the
+		// source key's spelling below.
+		keysBefore := 0
+		if d.config.Metadata != nil {
+			keysBefore = len(d.config.Metadata.Keys)
+		}
+
+		rawVal := rawMapVal.Interface()
+
+		// A field hook registered for this exact struct type and field
+		// pre-processes the raw value; the global DecodeHook still
+		// runs afterwards inside decode. An explicitly nil value has
+		// no type for the hook to inspect, so it goes straight down
+		// the normal nil path.
+		if hooks, ok := d.config.FieldHooks[f.owner]; ok && rawVal != nil {
+			if hook, ok := hooks[field.Name]; ok {
+				transformed, err := DecodeHookExec(
+					hook, fieldName, reflect.ValueOf(rawVal), fieldValue)
+				if err != nil {
+					errors = appendErrors(errors,
+						fmt.Errorf("error decoding '%s': %s", fieldName, err))
+					if d.config.StopOnError {
+						break
+					}
+					continue
+				}
+				rawVal = transformed
+			}
+		}
+
+		err := d.decode(fieldName, rawVal, fieldValue)
+
+		// Metadata.Keys gets the source map key's exact spelling even
+		// when MatchName matched it case-insensitively; the struct-side
+		// path stays available in Metadata.FieldPaths.
+		if d.config.Metadata != nil {
+			if sourceKey, ok := rawMapKey.Interface().(string); ok {
+				sourceName := sourceKey
+				if name != "" {
+					sourceName = name + "." + sourceKey
+				}
+				if sourceName != fieldName {
+					d.rewriteMetaKeys(keysBefore, fieldName, sourceName)
+				}
+			}
+		}
+
+		if err != nil {
 			errors = appendErrors(errors, err)
+			if d.config.StopOnError {
+				break
+			}
 		}
 	}
 
+	if d.config.ErrorUnset && len(unsetFields) > 0 {
+		sort.Strings(unsetFields)
+		err := fmt.Errorf(
+			"'%s' has unset fields: %s", name, strings.Join(unsetFields, ", "))
+		errors = appendErrors(errors, err)
+	}
+
+	if len(missingRequired) > 0 {
+		sort.Strings(missingRequired)
+		err := fmt.Errorf(
+			"missing required keys: %s", strings.Join(missingRequired, ", "))
+		errors = appendErrors(errors, err)
+	}
+
 	// If we have a "remain"-tagged field and we have unused keys then
 	// we put the unused keys directly into the remain field.
 	if remainField != nil && len(dataValKeysUnused) > 0 {
@@ -1410,7 +2518,13 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 	if d.config.ErrorUnused && len(dataValKeysUnused) > 0 {
 		keys := make([]string, 0, len(dataValKeysUnused))
 		for rawKey := range dataValKeysUnused {
-			keys = append(keys, rawKey.(string))
+			// Report the full path of each unused key so nested
+			// offenders can be located directly.
+			key := rawKey.(string)
+			if name != "" {
+				key = name + "." + key
+			}
+			keys = append(keys, key)
 		}
 		sort.Strings(keys)
 
@@ -1419,7 +2533,7 @@ func (d *Decoder) decodeStructFromMap(name string, dataVal, val reflect.Value) e
 	}
 
 	if len(errors) > 0 {
-		return &Error{errors}
+		return newError(errors)
 	}
 
 	// Add the unused keys to the list of unused keys if we're tracking metadata
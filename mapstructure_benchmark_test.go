@@ -283,3 +283,109 @@ func Benchmark_DecodeTagged(b *testing.B) {
 		Decode(input, &result)
 	}
 }
+
+func Benchmark_DecodeReuse(b *testing.B) {
+	input := map[string]interface{}{
+		"name":   "Mitchell",
+		"age":    91,
+		"emails": []string{"one", "two", "three"},
+		"extra": map[string]string{
+			"twitter": "mitchellh",
+		},
+	}
+
+	var result Person
+	config := &DecoderConfig{Result: &result}
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder.Decode(input)
+	}
+}
+
+func Benchmark_DecodeFreshDecoder(b *testing.B) {
+	input := map[string]interface{}{
+		"name":   "Mitchell",
+		"age":    91,
+		"emails": []string{"one", "two", "three"},
+		"extra": map[string]string{
+			"twitter": "mitchellh",
+		},
+	}
+
+	var result Person
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+		if err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		decoder.Decode(input)
+	}
+}
+
+func Benchmark_DecodeTaggedRepeated(b *testing.B) {
+	type Tagged struct {
+		Name   string            `mapstructure:"name"`
+		Age    int               `mapstructure:"age,omitempty"`
+		Emails []string          `mapstructure:"emails"`
+		Extra  map[string]string `mapstructure:"extra"`
+	}
+
+	input := map[string]interface{}{
+		"name":   "Mitchell",
+		"age":    91,
+		"emails": []string{"one", "two", "three"},
+		"extra": map[string]string{
+			"twitter": "mitchellh",
+		},
+	}
+
+	var result Tagged
+	decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder.Decode(input)
+	}
+}
+
+func Benchmark_DecodeInternStrings(b *testing.B) {
+	type Item struct {
+		Status string `mapstructure:"status"`
+	}
+
+	items := make([]map[string]interface{}, 1000)
+	for i := range items {
+		items[i] = map[string]interface{}{
+			"status": string([]byte("active")),
+		}
+	}
+
+	var result []Item
+	decoder, err := NewDecoder(&DecoderConfig{
+		InternStrings: true,
+		Result:        &result,
+	})
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result = result[:0]
+		if err := decoder.Decode(items); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
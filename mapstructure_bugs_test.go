@@ -26,7 +26,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{},
 		},
 		{
@@ -37,7 +37,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "baz", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{},
 		},
 		{
@@ -47,7 +47,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "foo", Vother: nil},
-			[]string{"Vother"},
+			[]string{"vother"},
 			[]string{},
 		},
 		{
@@ -59,7 +59,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{"vbar"},
 		},
 		{
@@ -70,7 +70,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{},
 		},
 		{
@@ -81,7 +81,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "baz", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{},
 		},
 		{
@@ -91,7 +91,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "foo", Vother: nil},
-			[]string{"Vother"},
+			[]string{"vother"},
 			[]string{},
 		},
 		{
@@ -103,7 +103,7 @@ func TestDecode_NilValue(t *testing.T) {
 			},
 			&Map{Vfoo: "foo", Vother: map[string]string{"foo": "bar"}},
 			&Map{Vfoo: "", Vother: nil},
-			[]string{"Vfoo", "Vother"},
+			[]string{"vfoo", "vother"},
 			[]string{"vbar"},
 		},
 	}
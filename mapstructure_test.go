@@ -1,12 +1,16 @@
 package mapstructure
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 type Basic struct {
@@ -1207,6 +1211,101 @@ func TestDecoder_ErrorUnused(t *testing.T) {
 	}
 }
 
+func TestDecoder_ErrorUnused_NestedPath(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+			"bogus":   "unknown",
+		},
+	}
+
+	var result Nested
+	config := &DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !strings.Contains(err.Error(), "Vbar.bogus") {
+		t.Errorf("expected full path of unused key in error: %s", err)
+	}
+}
+
+func TestDecoder_ErrorUnset(t *testing.T) {
+	t.Parallel()
+
+	type UnsetNested struct {
+		Vstring string `mapstructure:"vstring"`
+		Vint    int    `mapstructure:"vint"`
+	}
+
+	type Unset struct {
+		Vfoo    string      `mapstructure:"vfoo"`
+		Vbar    UnsetNested `mapstructure:"vbar"`
+		Skipped string      `mapstructure:"-"`
+	}
+
+	input := map[string]interface{}{
+		"vfoo": "foo",
+		"vbar": map[string]interface{}{
+			"vstring": "foo",
+		},
+	}
+
+	var result Unset
+	config := &DecoderConfig{
+		ErrorUnset: true,
+		Result:     &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !strings.Contains(err.Error(), "vbar.vint") {
+		t.Errorf("expected unset field path in error: %s", err)
+	}
+
+	if strings.Contains(err.Error(), "Skipped") {
+		t.Errorf("fields tagged - should not be reported: %s", err)
+	}
+
+	// A fully populated input decodes without error.
+	input["vbar"].(map[string]interface{})["vint"] = 42
+	var full Unset
+	config = &DecoderConfig{
+		ErrorUnset: true,
+		Result:     &full,
+	}
+
+	decoder, err = NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestDecoder_ErrorUnused_NotSetable(t *testing.T) {
 	t.Parallel()
 
@@ -2118,6 +2217,205 @@ func TestInvalidType(t *testing.T) {
 	}
 }
 
+func TestDecodeError(t *testing.T) {
+	t.Parallel()
+
+	// A direct scalar decode failure surfaces a *DecodeError carrying
+	// the field path and the expected/actual types.
+	var result int
+	err := Decode("foo", &result)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	derr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("error should be kind of DecodeError, instead: %#v", err)
+	}
+
+	if derr.Expected.Kind() != reflect.Int {
+		t.Errorf("bad expected type: %s", derr.Expected)
+	}
+
+	if derr.Actual.Kind() != reflect.String {
+		t.Errorf("bad actual type: %s", derr.Actual)
+	}
+
+	// Nested failures keep the dotted field path in the error, both in
+	// the aggregated message and in the DecodeError itself.
+	input := map[string]interface{}{
+		"vbar": map[string]interface{}{
+			"vstring": 42,
+		},
+	}
+
+	var nested Nested
+	err = Decode(input, &nested)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	if !strings.Contains(err.Error(), "'Vbar.Vstring'") {
+		t.Errorf("expected field path in error, got: %s", err)
+	}
+}
+
+func TestErrors_As(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]interface{}{
+		"vstring": 42,
+		"vint":    "foo",
+	}
+
+	var result Basic
+	err := Decode(input, &result)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected errors.As to extract Errors, instead: %#v", err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %s", len(errs), errs)
+	}
+
+	// The joined output must match the default string output.
+	if errs.Error() != err.Error() {
+		t.Errorf("joined output mismatch:\n%s\n---\n%s", errs.Error(), err.Error())
+	}
+
+	// Individual errors keep their field context.
+	var derr *DecodeError
+	if !errors.As(errs[0], &derr) && !errors.As(errs[1], &derr) {
+		t.Fatalf("expected a DecodeError among: %s", errs)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	t.Parallel()
+
+	type DefaultsNested struct {
+		Vstring string `mapstructure:"vstring,default=nested"`
+	}
+
+	type Defaults struct {
+		Port    int             `mapstructure:"port,default=8080"`
+		Host    string          `mapstructure:"host,default=localhost"`
+		Debug   bool            `mapstructure:"debug,default=true"`
+		Nested  DefaultsNested  `mapstructure:"nested"`
+		Pointer *DefaultsNested `mapstructure:"pointer"`
+	}
+
+	input := map[string]interface{}{
+		"host":    "example.com",
+		"nested":  map[string]interface{}{},
+		"pointer": map[string]interface{}{},
+	}
+
+	var result Defaults
+	config := &DecoderConfig{
+		ApplyDefaults: true,
+		Result:        &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+
+	if result.Port != 8080 {
+		t.Errorf("port should be 8080: %#v", result.Port)
+	}
+
+	if result.Host != "example.com" {
+		t.Errorf("host should keep input value: %#v", result.Host)
+	}
+
+	if !result.Debug {
+		t.Errorf("debug should default to true")
+	}
+
+	if result.Nested.Vstring != "nested" {
+		t.Errorf("nested default should apply: %#v", result.Nested.Vstring)
+	}
+
+	if result.Pointer == nil || result.Pointer.Vstring != "nested" {
+		t.Errorf("pointer default should apply: %#v", result.Pointer)
+	}
+
+	// Defaults are ignored unless ApplyDefaults is set.
+	var plain Defaults
+	if err := Decode(map[string]interface{}{}, &plain); err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+
+	if plain.Port != 0 {
+		t.Errorf("port should be zero without ApplyDefaults: %#v", plain.Port)
+	}
+}
+
+func TestErrorOnMissingRequired(t *testing.T) {
+	t.Parallel()
+
+	type RequiredNested struct {
+		Token string `mapstructure:"token,required"`
+	}
+
+	type Required struct {
+		APIKey   string          `mapstructure:"api_key,required"`
+		Host     string          `mapstructure:"host,required"`
+		Optional string          `mapstructure:"optional"`
+		Nested   RequiredNested  `mapstructure:"nested"`
+		Pointer  *RequiredNested `mapstructure:"pointer,required"`
+	}
+
+	input := map[string]interface{}{
+		"nested":  map[string]interface{}{},
+		"pointer": nil,
+	}
+
+	var result Required
+	config := &DecoderConfig{
+		ErrorOnMissingRequired: true,
+		Result:                 &result,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatal("error should exist")
+	}
+
+	// Every missing required field is reported in one pass; the
+	// explicit nil for "pointer" counts as present.
+	for _, want := range []string{"api_key", "host", "nested.token"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error: %s", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "pointer") {
+		t.Errorf("pointer was present (nil) and should not be reported: %s", err)
+	}
+
+	// Required tags are ignored unless the option is set.
+	var plain Required
+	if err := Decode(map[string]interface{}{}, &plain); err != nil {
+		t.Fatalf("err: %s", err.Error())
+	}
+}
+
 func TestDecodeMetadata(t *testing.T) {
 	t.Parallel()
 
@@ -2140,7 +2438,7 @@ func TestDecodeMetadata(t *testing.T) {
 		t.Fatalf("err: %s", err.Error())
 	}
 
-	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
+	expectedKeys := []string{"vbar", "vbar.Vuint", "vbar.vstring", "vfoo"}
 	sort.Strings(md.Keys)
 	if !reflect.DeepEqual(md.Keys, expectedKeys) {
 		t.Fatalf("bad keys: %#v", md.Keys)
@@ -2189,7 +2487,7 @@ func TestMetadata(t *testing.T) {
 		t.Fatalf("err: %s", err.Error())
 	}
 
-	expectedKeys := []string{"Vbar", "Vbar.Vstring", "Vbar.Vuint", "Vfoo"}
+	expectedKeys := []string{"vbar", "vbar.Vuint", "vbar.vstring", "vfoo"}
 	sort.Strings(md.Keys)
 	if !reflect.DeepEqual(md.Keys, expectedKeys) {
 		t.Fatalf("bad keys: %#v", md.Keys)
@@ -2227,7 +2525,7 @@ func TestMetadata_Embedded(t *testing.T) {
 		t.Fatalf("err: %s", err.Error())
 	}
 
-	expectedKeys := []string{"Vstring", "Vunique"}
+	expectedKeys := []string{"vstring", "vunique"}
 
 	sort.Strings(md.Keys)
 	if !reflect.DeepEqual(md.Keys, expectedKeys) {
@@ -2327,7 +2625,7 @@ func TestWeakDecodeMetadata(t *testing.T) {
 		t.Fatalf("bad: %#v", result)
 	}
 
-	expectedKeys := []string{"Bar", "Foo"}
+	expectedKeys := []string{"bar", "foo"}
 	sort.Strings(md.Keys)
 	if !reflect.DeepEqual(md.Keys, expectedKeys) {
 		t.Fatalf("bad keys: %#v", md.Keys)
@@ -2482,6 +2780,70 @@ func TestDecoder_MatchName(t *testing.T) {
 	}
 }
 
+func TestDecoder_MatchNameComparators(t *testing.T) {
+	t.Parallel()
+
+	type Target struct {
+		APIKey string `mapstructure:"api_key"`
+	}
+
+	// The exact comparator rejects differently-cased keys.
+	var exact Target
+	config := &DecoderConfig{
+		Result:    &exact,
+		MatchName: ExactMatchName,
+	}
+
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(map[string]interface{}{"API_KEY": "secret"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if exact.APIKey != "" {
+		t.Errorf("exact match should not fill field: %#v", exact.APIKey)
+	}
+
+	// The case-insensitive comparator accepts them.
+	var insensitive Target
+	config = &DecoderConfig{
+		Result:    &insensitive,
+		MatchName: CaseInsensitiveMatchName,
+	}
+
+	decoder, err = NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(map[string]interface{}{"API_KEY": "secret"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if insensitive.APIKey != "secret" {
+		t.Errorf("insensitive match should fill field: %#v", insensitive.APIKey)
+	}
+
+	// When several keys match one field, the first in lexical key
+	// order wins, deterministically.
+	for i := 0; i < 10; i++ {
+		var result Target
+		if err := Decode(map[string]interface{}{
+			"Api_Key": "b",
+			"API_KEY": "a",
+		}, &result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if result.APIKey != "a" {
+			t.Fatalf("expected lexically first key to win, got %#v", result.APIKey)
+		}
+	}
+}
+
 func testSliceInput(t *testing.T, input map[string]interface{}, expected *Slice) {
 	var result Slice
 	err := Decode(input, &result)
@@ -2544,3 +2906,1929 @@ func uintPtr(v uint) *uint                    { return &v }
 func boolPtr(v bool) *bool                    { return &v }
 func floatPtr(v float64) *float64             { return &v }
 func interfacePtr(v interface{}) *interface{} { return &v }
+
+func TestDecoder_EmptyStringAsZero(t *testing.T) {
+	type Config struct {
+		Vint      int
+		Vfloat    float64
+		Vbool     bool
+		Vduration time.Duration
+		Vstring   string
+	}
+
+	input := map[string]interface{}{
+		"vint":      "",
+		"vfloat":    "",
+		"vbool":     "",
+		"vduration": "",
+		"vstring":   "",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:        StringToTimeDurationHookFunc(),
+		EmptyStringAsZero: true,
+		Result:            &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Config{}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Without the option the empty strings are an error.
+	var result2 Config
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: StringToTimeDurationHookFunc(),
+		Result:     &result2,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_TrackTypes(t *testing.T) {
+	type Nested struct {
+		Vint int
+	}
+	type Config struct {
+		Vstring string
+		Vbar    Nested
+		Vslice  []string
+	}
+
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"vbar": map[string]interface{}{
+			"vint": 5,
+		},
+		"vslice": []interface{}{"a", "b"},
+	}
+
+	var md Metadata
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		Metadata:   &md,
+		TrackTypes: true,
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]DecodeTypes{
+		"vstring":   {Source: "string", Target: "string"},
+		"vbar":      {Source: "map[string]interface {}", Target: "mapstructure.Nested"},
+		"vbar.vint": {Source: "int", Target: "int"},
+		"vslice":    {Source: "[]interface {}", Target: "[]string"},
+		"vslice[0]": {Source: "string", Target: "string"},
+		"vslice[1]": {Source: "string", Target: "string"},
+	}
+	if !reflect.DeepEqual(md.Types, expected) {
+		t.Fatalf("bad: %#v", md.Types)
+	}
+
+	// Without TrackTypes nothing is recorded.
+	var md2 Metadata
+	var result2 Config
+	decoder, err = NewDecoder(&DecoderConfig{
+		Metadata: &md2,
+		Result:   &result2,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if md2.Types != nil {
+		t.Fatalf("bad: %#v", md2.Types)
+	}
+}
+
+func TestDecoder_MetadataDefaulted(t *testing.T) {
+	type Config struct {
+		Port int    `mapstructure:"port,default=8080"`
+		Host string `mapstructure:"host,default=localhost"`
+	}
+
+	var md Metadata
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ApplyDefaults: true,
+		Metadata:      &md,
+		Result:        &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"host": "example.com",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Port != 8080 || result.Host != "example.com" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if !reflect.DeepEqual(md.Defaulted, []string{"port"}) {
+		t.Fatalf("bad: %#v", md.Defaulted)
+	}
+}
+
+func TestDecoder_TagNamesFallback(t *testing.T) {
+	type Config struct {
+		Vfoo   string `mapstructure:"foo" json:"foo_json"`
+		Vbar   string `json:"bar,omitempty"`
+		Vempty string `json:",omitempty"`
+		Vbaz   string
+	}
+
+	input := map[string]interface{}{
+		"foo":    "from-mapstructure",
+		"bar":    "from-json",
+		"vempty": "by-field-name",
+		"vbaz":   "by-field-name",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		TagNames: []string{"mapstructure", "json"},
+		Result:   &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Config{
+		Vfoo:   "from-mapstructure",
+		Vbar:   "from-json",
+		Vempty: "by-field-name",
+		Vbaz:   "by-field-name",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_SquashEmbeddedPointer(t *testing.T) {
+	type Base struct {
+		Vcommon string `mapstructure:"common"`
+	}
+	type Middle struct {
+		*Base  `mapstructure:",squash"`
+		Vlevel string `mapstructure:"level"`
+	}
+	type Config struct {
+		*Middle `mapstructure:",squash"`
+		Vname   string `mapstructure:"name"`
+	}
+
+	// Keys present: every pointer level is allocated.
+	var result Config
+	err := Decode(map[string]interface{}{
+		"name":   "foo",
+		"level":  "mid",
+		"common": "base",
+	}, &result)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Vname != "foo" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result.Middle == nil || result.Middle.Vlevel != "mid" {
+		t.Fatalf("bad: %#v", result.Middle)
+	}
+	if result.Middle.Base == nil || result.Middle.Base.Vcommon != "base" {
+		t.Fatalf("bad: %#v", result.Middle.Base)
+	}
+
+	// No matching keys: the embedded pointers stay nil.
+	var result2 Config
+	err = Decode(map[string]interface{}{
+		"name": "foo",
+	}, &result2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result2.Middle != nil {
+		t.Fatalf("bad: %#v", result2.Middle)
+	}
+
+	// A key two levels down still allocates the outer pointer.
+	var result3 Config
+	err = Decode(map[string]interface{}{
+		"common": "base",
+	}, &result3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result3.Middle == nil || result3.Middle.Base == nil ||
+		result3.Middle.Base.Vcommon != "base" {
+		t.Fatalf("bad: %#v", result3)
+	}
+}
+
+func TestDecoder_SquashTypes(t *testing.T) {
+	// Stands in for a third-party type whose tags we cannot edit.
+	type LibraryBase struct {
+		Vcommon string `mapstructure:"common"`
+	}
+	type Tagged struct {
+		Vother string `mapstructure:"other"`
+	}
+	type Config struct {
+		LibraryBase
+		Tagged `mapstructure:",squash"`
+		Vname  string `mapstructure:"name"`
+	}
+
+	input := map[string]interface{}{
+		"name":   "foo",
+		"common": "base",
+		"other":  "tagged",
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		SquashTypes: []reflect.Type{reflect.TypeOf(LibraryBase{})},
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Vname != "foo" || result.Vcommon != "base" || result.Vother != "tagged" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Without the registration the embedded struct is keyed by name.
+	var result2 Config
+	if err := Decode(input, &result2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result2.Vcommon != "" || result2.Vother != "tagged" {
+		t.Fatalf("bad: %#v", result2)
+	}
+}
+
+func TestRemainder_Nested(t *testing.T) {
+	type Inner struct {
+		Vname string                 `mapstructure:"name"`
+		Extra map[string]interface{} `mapstructure:",remain"`
+	}
+	type Outer struct {
+		Vinner Inner                  `mapstructure:"inner"`
+		Vfoo   string                 `mapstructure:"foo"`
+		Extra  map[string]interface{} `mapstructure:",remain"`
+	}
+
+	input := map[string]interface{}{
+		"foo": "bar",
+		"inner": map[string]interface{}{
+			"name":  "alice",
+			"other": "leftover-inner",
+		},
+		"other": "leftover-outer",
+	}
+
+	// Keys consumed by a remain field are not unused, so ErrorUnused
+	// must not fire at either level.
+	var result Outer
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnused: true,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Outer{
+		Vfoo: "bar",
+		Vinner: Inner{
+			Vname: "alice",
+			Extra: map[string]interface{}{"other": "leftover-inner"},
+		},
+		Extra: map[string]interface{}{"other": "leftover-outer"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_NormalizeKeys(t *testing.T) {
+	type Inner struct {
+		Vname string `mapstructure:"name"`
+	}
+	type Config struct {
+		Vfoo    string  `mapstructure:"foo"`
+		Vinner  Inner   `mapstructure:"inner"`
+		Vinners []Inner `mapstructure:"inners"`
+	}
+
+	input := map[string]interface{}{
+		"FOO": "bar",
+		"Inner": map[string]interface{}{
+			"NAME": "alice",
+		},
+		"INNERS": []interface{}{
+			map[string]interface{}{"Name": "bob"},
+			map[interface{}]interface{}{"NAME": "carol"},
+		},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		NormalizeKeys: strings.ToLower,
+		MatchName:     ExactMatchName,
+		Result:        &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Config{
+		Vfoo:    "bar",
+		Vinner:  Inner{Vname: "alice"},
+		Vinners: []Inner{{Vname: "bob"}, {Vname: "carol"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// The caller's input must not be mutated.
+	if _, ok := input["FOO"]; !ok {
+		t.Fatalf("input mutated: %#v", input)
+	}
+}
+
+func TestDecoder_Reset(t *testing.T) {
+	var md Metadata
+	var first, second Basic
+
+	config := &DecoderConfig{
+		Metadata: &md,
+		Result:   &first,
+	}
+	decoder, err := NewDecoder(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"vstring": "foo",
+		"unused":  true,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(md.Keys) != 1 || len(md.Unused) != 1 {
+		t.Fatalf("bad: %#v", md)
+	}
+
+	config.Result = &second
+	if err := decoder.Reset(config); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Accumulated metadata is cleared by Reset.
+	if len(md.Keys) != 0 || len(md.Unused) != 0 {
+		t.Fatalf("bad: %#v", md)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"vstring": "bar",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if first.Vstring != "foo" || second.Vstring != "bar" {
+		t.Fatalf("bad: %#v %#v", first, second)
+	}
+	if !reflect.DeepEqual(md.Keys, []string{"vstring"}) {
+		t.Fatalf("bad: %#v", md.Keys)
+	}
+}
+
+func TestStructFieldTagsCached(t *testing.T) {
+	type Config struct {
+		Vfoo string `mapstructure:"foo,omitempty"`
+		Vbar string
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	typ := reflect.TypeOf(Config{})
+	first := decoder.structFieldTags(typ)
+	second := decoder.structFieldTags(typ)
+
+	expected := []fieldTagInfo{
+		{name: "foo", options: []string{"omitempty"}, tagged: true},
+		{name: "", options: []string{}},
+	}
+	if !reflect.DeepEqual(first, expected) {
+		t.Fatalf("bad: %#v", first)
+	}
+	if !reflect.DeepEqual(second, expected) {
+		t.Fatalf("bad: %#v", second)
+	}
+
+	// A different tag configuration must not reuse the entry.
+	var result2 Config
+	decoder2, err := NewDecoder(&DecoderConfig{
+		TagName: "json",
+		Result:  &result2,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	other := decoder2.structFieldTags(typ)
+	if other[0].name != "" {
+		t.Fatalf("bad: %#v", other)
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	type Config struct {
+		Vfoo string `mapstructure:"foo"`
+		Vint int    `mapstructure:"int"`
+	}
+
+	input := map[string]interface{}{
+		"foo": "bar",
+		"int": 5,
+	}
+
+	result, err := DecodeAs[Config](input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vfoo != "bar" || result.Vint != 5 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Pointer type parameter.
+	ptrResult, err := DecodeAs[*Config](input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ptrResult == nil || ptrResult.Vfoo != "bar" {
+		t.Fatalf("bad: %#v", ptrResult)
+	}
+
+	// Maps and slices.
+	mapResult, err := DecodeAs[map[string]interface{}](input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mapResult["foo"] != "bar" {
+		t.Fatalf("bad: %#v", mapResult)
+	}
+
+	sliceResult, err := DecodeAs[[]int]([]interface{}{1, 2, 3})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(sliceResult, []int{1, 2, 3}) {
+		t.Fatalf("bad: %#v", sliceResult)
+	}
+
+	// Errors return the zero value.
+	badResult, err := DecodeAs[Config](map[string]interface{}{
+		"int": "not-an-int",
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !reflect.DeepEqual(badResult, Config{}) {
+		t.Fatalf("bad: %#v", badResult)
+	}
+}
+
+func TestDecodeAsWithConfig(t *testing.T) {
+	type Config struct {
+		Vint int `mapstructure:"int"`
+	}
+
+	result, err := DecodeAsWithConfig[Config](map[string]interface{}{
+		"int": "5",
+	}, &DecoderConfig{WeaklyTypedInput: true})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vint != 5 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_CaptureInput(t *testing.T) {
+	input := map[string]interface{}{
+		"vstring": "foo",
+		"ignored": true,
+	}
+
+	var md Metadata
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{
+		CaptureInput: true,
+		Metadata:     &md,
+		Result:       &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	captured, ok := md.Input.(map[string]interface{})
+	if !ok {
+		t.Fatalf("bad: %#v", md.Input)
+	}
+	if !reflect.DeepEqual(captured, input) {
+		t.Fatalf("bad: %#v", captured)
+	}
+
+	// Same underlying map, not a copy.
+	input["extra"] = "later"
+	if captured["extra"] != "later" {
+		t.Fatalf("bad: %#v", captured)
+	}
+
+	// Without the option nothing is retained.
+	var md2 Metadata
+	var result2 Basic
+	decoder, err = NewDecoder(&DecoderConfig{
+		Metadata: &md2,
+		Result:   &result2,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if md2.Input != nil {
+		t.Fatalf("bad: %#v", md2.Input)
+	}
+
+	// NormalizeKeys does not leak into the capture; the raw source
+	// with its original spelling is retained.
+	rawInput := map[string]interface{}{
+		"VSTRING": "foo",
+	}
+	var md3 Metadata
+	var result3 Basic
+	decoder, err = NewDecoder(&DecoderConfig{
+		CaptureInput:  true,
+		NormalizeKeys: strings.ToLower,
+		Metadata:      &md3,
+		Result:        &result3,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(rawInput); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result3.Vstring != "foo" {
+		t.Fatalf("bad: %#v", result3.Vstring)
+	}
+	captured, ok = md3.Input.(map[string]interface{})
+	if !ok {
+		t.Fatalf("bad: %#v", md3.Input)
+	}
+	if _, ok := captured["VSTRING"]; !ok {
+		t.Fatalf("bad: %#v", captured)
+	}
+}
+
+func TestDecoder_TypeRegistry(t *testing.T) {
+	type Circle struct {
+		Type   string  `mapstructure:"type"`
+		Radius float64 `mapstructure:"radius"`
+	}
+	type Rectangle struct {
+		Type   string  `mapstructure:"type"`
+		Width  float64 `mapstructure:"width"`
+		Height float64 `mapstructure:"height"`
+	}
+	type Canvas struct {
+		Shapes []interface{} `mapstructure:"shapes"`
+	}
+
+	registry := map[string]reflect.Type{
+		"circle":    reflect.TypeOf(Circle{}),
+		"rectangle": reflect.TypeOf(Rectangle{}),
+	}
+
+	var result Canvas
+	decoder, err := NewDecoder(&DecoderConfig{
+		TypeRegistry: registry,
+		Result:       &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"shapes": []interface{}{
+			map[string]interface{}{"type": "circle", "radius": 2.5},
+			map[string]interface{}{"type": "rectangle", "width": 3.0, "height": 4.0},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := Canvas{
+		Shapes: []interface{}{
+			Circle{Type: "circle", Radius: 2.5},
+			Rectangle{Type: "rectangle", Width: 3, Height: 4},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Unknown discriminators error and name the valid values.
+	var result2 Canvas
+	decoder, err = NewDecoder(&DecoderConfig{
+		TypeRegistry: registry,
+		Result:       &result2,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"shapes": []interface{}{
+			map[string]interface{}{"type": "triangle"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "circle, rectangle") {
+		t.Fatalf("bad error: %s", err)
+	}
+
+	// A custom discriminator key.
+	type Doc struct {
+		Item interface{} `mapstructure:"item"`
+	}
+
+	var doc Doc
+	decoder, err = NewDecoder(&DecoderConfig{
+		TypeRegistry: registry,
+		TypeField:    "kind",
+		Result:       &doc,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{
+		"item": map[string]interface{}{"kind": "circle", "radius": 1.0},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if c, ok := doc.Item.(Circle); !ok || c.Radius != 1 {
+		t.Fatalf("bad: %#v", doc.Item)
+	}
+}
+
+func TestDecoder_DecodeContext(t *testing.T) {
+	input := map[string]interface{}{
+		"vstring": "foo",
+	}
+
+	// A context that is still live decodes normally.
+	var result Basic
+	decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.DecodeContext(context.Background(), input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Vstring != "foo" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Cancelling mid-decode aborts the remaining work.
+	large := make([]interface{}, 1000)
+	for i := range large {
+		large[i] = map[string]interface{}{"vstring": "foo"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	var results []Basic
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook: func(f reflect.Value, t reflect.Value) (interface{}, error) {
+			calls++
+			if calls == 10 {
+				cancel()
+			}
+			return f.Interface(), nil
+		},
+		Result: &results,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.DecodeContext(ctx, large)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("bad error: %s", err)
+	}
+
+	// A pre-cancelled context fails immediately with ctx.Err().
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+
+	var result2 Basic
+	decoder, err = NewDecoder(&DecoderConfig{Result: &result2})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.DecodeContext(ctx2, input); err != context.Canceled {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestDecoder_SliceMergeMode(t *testing.T) {
+	type Item struct {
+		Vname string `mapstructure:"name"`
+		Vint  int    `mapstructure:"int"`
+	}
+	type Config struct {
+		Items []Item `mapstructure:"items"`
+	}
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "one"},
+		},
+	}
+
+	newResult := func() Config {
+		return Config{
+			Items: []Item{
+				{Vname: "existing", Vint: 5},
+				{Vname: "kept", Vint: 7},
+			},
+		}
+	}
+
+	// Replace (the default): source decodes from index zero.
+	result := newResult()
+	decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Items[0].Vname != "one" {
+		t.Fatalf("bad: %#v", result.Items)
+	}
+
+	// Append: source elements land after the existing ones.
+	result = newResult()
+	decoder, err = NewDecoder(&DecoderConfig{
+		SliceMergeMode: SliceMergeAppend,
+		Result:         &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []Item{
+		{Vname: "existing", Vint: 5},
+		{Vname: "kept", Vint: 7},
+		{Vname: "one"},
+	}
+	if !reflect.DeepEqual(result.Items, expected) {
+		t.Fatalf("bad: %#v", result.Items)
+	}
+
+	// MergeByIndex: fields merge into the element at the same index
+	// and elements past the source length keep their values.
+	result = newResult()
+	decoder, err = NewDecoder(&DecoderConfig{
+		SliceMergeMode: SliceMergeByIndex,
+		Result:         &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected = []Item{
+		{Vname: "one", Vint: 5},
+		{Vname: "kept", Vint: 7},
+	}
+	if !reflect.DeepEqual(result.Items, expected) {
+		t.Fatalf("bad: %#v", result.Items)
+	}
+
+	// MergeByIndex with a longer source grows the slice.
+	result = newResult()
+	decoder, err = NewDecoder(&DecoderConfig{
+		SliceMergeMode: SliceMergeByIndex,
+		Result:         &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err = decoder.Decode(map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "one"},
+			map[string]interface{}{"name": "two"},
+			map[string]interface{}{"name": "three"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(result.Items) != 3 || result.Items[2].Vname != "three" {
+		t.Fatalf("bad: %#v", result.Items)
+	}
+}
+
+func TestDecoder_MergeMaps(t *testing.T) {
+	input := map[string]interface{}{
+		"outer": map[string]interface{}{
+			"b": 2,
+			"nested": map[string]interface{}{
+				"y": 2,
+			},
+		},
+	}
+
+	newTarget := func() map[string]interface{} {
+		return map[string]interface{}{
+			"outer": map[string]interface{}{
+				"a": 1,
+				"nested": map[string]interface{}{
+					"x": 1,
+				},
+			},
+			"untouched": true,
+		}
+	}
+
+	// Default: colliding keys are overwritten wholesale.
+	result := newTarget()
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	outer := result["outer"].(map[string]interface{})
+	if _, ok := outer["a"]; ok {
+		t.Fatalf("bad: %#v", outer)
+	}
+
+	// MergeMaps: nested maps merge recursively.
+	result = newTarget()
+	decoder, err := NewDecoder(&DecoderConfig{
+		MergeMaps: true,
+		Result:    &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]interface{}{
+		"outer": map[string]interface{}{
+			"a": 1,
+			"b": 2,
+			"nested": map[string]interface{}{
+				"x": 1,
+				"y": 2,
+			},
+		},
+		"untouched": true,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_DecodeNil(t *testing.T) {
+	type Patch struct {
+		Name  *string `mapstructure:"name"`
+		Email *string `mapstructure:"email"`
+		Age   *int    `mapstructure:"age"`
+	}
+
+	input := map[string]interface{}{
+		"name": "foo",
+		"age":  nil,
+	}
+
+	var md Metadata
+	var result Patch
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeNil: true,
+		Metadata:  &md,
+		Result:    &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Name == nil || *result.Name != "foo" {
+		t.Fatalf("bad: %#v", result.Name)
+	}
+	if result.Age != nil {
+		t.Fatalf("bad: %#v", result.Age)
+	}
+
+	// "age" was present with an explicit nil; "email" was absent.
+	if !reflect.DeepEqual(md.ExplicitNil, []string{"age"}) {
+		t.Fatalf("bad: %#v", md.ExplicitNil)
+	}
+}
+
+type textKey string
+
+func (k *textKey) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty map key")
+	}
+
+	*k = textKey(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestDecodeMap_textUnmarshalerKey(t *testing.T) {
+	input := map[string]string{
+		"foo": "bar",
+		"baz": "qux",
+	}
+
+	var result map[textKey]string
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[textKey]string{
+		"FOO": "bar",
+		"BAZ": "qux",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// A key the unmarshaler rejects must surface its error.
+	result = nil
+	if err := Decode(map[string]string{"": "bar"}, &result); err == nil {
+		t.Fatalf("expected error for invalid map key")
+	}
+}
+
+func TestDecoder_StopOnError(t *testing.T) {
+	type Config struct {
+		Port  int  `mapstructure:"port"`
+		Debug bool `mapstructure:"debug"`
+		Name  string
+	}
+
+	input := map[string]interface{}{
+		"port":  "not-a-number",
+		"debug": "not-a-bool",
+		"Name":  "foo",
+	}
+
+	// Default: every independent error is collected, and clean fields
+	// still get their values.
+	var result Config
+	err := Decode(input, &result)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(err.(*Error).Errors) != 2 {
+		t.Fatalf("bad: %#v", err)
+	}
+	if result.Name != "foo" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// StopOnError: only the first error is reported.
+	result = Config{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		StopOnError: true,
+		Result:      &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(err.(*Error).Errors) != 1 {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestDecoder_PostFieldHook(t *testing.T) {
+	type Server struct {
+		Port int
+		Host string
+	}
+	type Config struct {
+		Server Server
+	}
+
+	input := map[string]interface{}{
+		"Server": map[string]interface{}{
+			"Port": -1,
+			"Host": "localhost",
+		},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		PostFieldHook: func(path string, v reflect.Value) error {
+			if strings.HasSuffix(path, "Port") && v.Int() < 0 {
+				return errors.New("port must not be negative")
+			}
+			return nil
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	derr := err.(*Error)
+	if len(derr.Errors) != 1 {
+		t.Fatalf("bad: %#v", derr.Errors)
+	}
+	if !strings.Contains(derr.Errors[0], "'Server.Port'") {
+		t.Fatalf("bad: %s", derr.Errors[0])
+	}
+
+	// The valid sibling field is still decoded.
+	if result.Server.Host != "localhost" {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_ZeroFieldsPerKind(t *testing.T) {
+	type Inner struct {
+		A string
+		B string
+	}
+	type Target struct {
+		Map   map[string]string
+		Slice []string
+		Ptr   *Inner
+	}
+
+	newTarget := func() Target {
+		return Target{
+			Map:   map[string]string{"keep": "old", "hit": "old"},
+			Slice: []string{"old0", "old1", "old2"},
+			Ptr:   &Inner{A: "old", B: "old"},
+		}
+	}
+
+	input := map[string]interface{}{
+		"Map":   map[string]string{"hit": "new"},
+		"Slice": []string{"new0"},
+		"Ptr":   map[string]interface{}{"A": "new"},
+	}
+
+	// ZeroFields false: merge into the existing values.
+	result := newTarget()
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expectedMap := map[string]string{"keep": "old", "hit": "new"}
+	if !reflect.DeepEqual(result.Map, expectedMap) {
+		t.Fatalf("bad map: %#v", result.Map)
+	}
+	if !reflect.DeepEqual(result.Slice, []string{"new0", "old1", "old2"}) {
+		t.Fatalf("bad slice: %#v", result.Slice)
+	}
+	if *result.Ptr != (Inner{A: "new", B: "old"}) {
+		t.Fatalf("bad ptr: %#v", result.Ptr)
+	}
+
+	// ZeroFields true: clear each target before decoding.
+	result = newTarget()
+	decoder, err := NewDecoder(&DecoderConfig{
+		ZeroFields: true,
+		Result:     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(result.Map, map[string]string{"hit": "new"}) {
+		t.Fatalf("bad map: %#v", result.Map)
+	}
+	if !reflect.DeepEqual(result.Slice, []string{"new0"}) {
+		t.Fatalf("bad slice: %#v", result.Slice)
+	}
+	if *result.Ptr != (Inner{A: "new"}) {
+		t.Fatalf("bad ptr: %#v", result.Ptr)
+	}
+
+	// ZeroFields true with a squashed non-nil embedded struct
+	// pointer: the pointee is zeroed and the squash still works.
+	type Squashed struct {
+		*Inner `mapstructure:",squash"`
+	}
+	squashed := Squashed{Inner: &Inner{A: "old", B: "old"}}
+	decoder, err = NewDecoder(&DecoderConfig{
+		ZeroFields: true,
+		Result:     &squashed,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"A": "new"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if squashed.Inner == nil || *squashed.Inner != (Inner{A: "new"}) {
+		t.Fatalf("bad squash: %#v", squashed.Inner)
+	}
+}
+
+type Celsius float64
+
+func TestDecode_embeddedNonStruct(t *testing.T) {
+	// An embedded non-struct type is a regular field under its type
+	// name, with or without the Squash option.
+	type Reading struct {
+		Celsius
+		Sensor string
+	}
+
+	input := map[string]interface{}{
+		"Celsius": 21.5,
+		"Sensor":  "roof",
+	}
+
+	var result Reading
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Celsius != 21.5 || result.Sensor != "roof" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	result = Reading{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		Squash: true,
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Celsius != 21.5 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Explicitly tagging an embedded non-struct with squash is an
+	// error, not a silent ignore.
+	type Tagged struct {
+		Celsius `mapstructure:",squash"`
+	}
+
+	var tagged Tagged
+	err = Decode(map[string]interface{}{"Celsius": 21.5}, &tagged)
+	if err == nil {
+		t.Fatalf("expected squash error")
+	} else if !strings.Contains(err.Error(), "unsupported type for squash") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestDecoder_InternStrings(t *testing.T) {
+	type Item struct {
+		Status string `mapstructure:"status"`
+	}
+
+	items := make([]map[string]interface{}, 100)
+	for i := range items {
+		// Build fresh string values so equal contents arrive with
+		// distinct backing storage.
+		items[i] = map[string]interface{}{
+			"status": string([]byte("active")),
+		}
+	}
+
+	var result []Item
+	decoder, err := NewDecoder(&DecoderConfig{
+		InternStrings: true,
+		Result:        &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(items); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for i, item := range result {
+		if item.Status != "active" {
+			t.Fatalf("bad item %d: %#v", i, item)
+		}
+	}
+
+	// All hundred values collapse to a single interned entry.
+	if len(decoder.interned) != 1 {
+		t.Fatalf("bad intern table: %#v", decoder.interned)
+	}
+}
+
+func TestDecoder_ErrorUnsupportedKinds(t *testing.T) {
+	type Config struct {
+		Name   string
+		Events chan string
+		Filter func(string) bool
+	}
+
+	input := map[string]interface{}{
+		"Name":   "foo",
+		"Events": "not-a-chan",
+		"Filter": "not-a-func",
+	}
+
+	// Default: unsupported kinds are skipped, the rest decodes.
+	var result Config
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Name != "foo" || result.Events != nil || result.Filter != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// ErrorUnsupportedKinds: each offending field is named.
+	result = Config{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorUnsupportedKinds: true,
+		Result:                &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(input)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "Events: unsupported kind: chan") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !strings.Contains(err.Error(), "'Filter'") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestDecoder_Plan(t *testing.T) {
+	type Config struct {
+		Name string `mapstructure:"name"`
+		Port int    `mapstructure:"port"`
+	}
+
+	input := map[string]interface{}{
+		"name":  "foo",
+		"port":  8080,
+		"extra": true,
+	}
+
+	result := Config{Name: "untouched"}
+	decoder, err := NewDecoder(&DecoderConfig{Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actions, err := decoder.Plan(input)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The target must not be mutated.
+	if result.Name != "untouched" || result.Port != 0 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	byPath := map[string]FieldAction{}
+	for _, action := range actions {
+		byPath[action.Path] = action
+	}
+
+	if action := byPath["name"]; !action.WouldSet || action.FromType != "string" || action.ToType != "string" {
+		t.Fatalf("bad: %#v", action)
+	}
+	if action := byPath["port"]; !action.WouldSet || action.ToType != "int" {
+		t.Fatalf("bad: %#v", action)
+	}
+	if action := byPath["extra"]; action.WouldSet {
+		t.Fatalf("bad: %#v", action)
+	}
+
+	// Plan reports the same fields Decode sets.
+	var md Metadata
+	result = Config{}
+	decoder, err = NewDecoder(&DecoderConfig{Metadata: &md, Result: &result})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var planned []string
+	for _, action := range actions {
+		if action.WouldSet {
+			planned = append(planned, action.Path)
+		}
+	}
+	sort.Strings(planned)
+	sort.Strings(md.Keys)
+	if !reflect.DeepEqual(planned, md.Keys) {
+		t.Fatalf("bad: %#v != %#v", planned, md.Keys)
+	}
+}
+
+func TestDecoder_UseNumber(t *testing.T) {
+	big := int64(1) << 60
+
+	input := map[string]interface{}{
+		"value": big,
+		"pi":    3.14,
+	}
+
+	var result struct {
+		Value interface{} `mapstructure:"value"`
+		Pi    interface{} `mapstructure:"pi"`
+	}
+	decoder, err := NewDecoder(&DecoderConfig{
+		UseNumber: true,
+		Result:    &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	number, ok := result.Value.(json.Number)
+	if !ok {
+		t.Fatalf("bad: %#v", result.Value)
+	}
+	roundTrip, err := number.Int64()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if roundTrip != big {
+		t.Fatalf("bad: %d != %d", roundTrip, big)
+	}
+
+	if _, ok := result.Pi.(json.Number); !ok {
+		t.Fatalf("bad: %#v", result.Pi)
+	}
+
+	// Without the option the original types pass through.
+	var plain struct {
+		Value interface{} `mapstructure:"value"`
+	}
+	if err := Decode(input, &plain); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := plain.Value.(int64); !ok {
+		t.Fatalf("bad: %#v", plain.Value)
+	}
+}
+
+func TestDecoder_IgnoreUntaggedFields(t *testing.T) {
+	type Config struct {
+		Name     string `mapstructure:"name"`
+		Port     int    `mapstructure:"port"`
+		internal string
+		Cache    map[string]string
+	}
+
+	input := map[string]interface{}{
+		"name":  "foo",
+		"port":  8080,
+		"Cache": map[string]string{"poisoned": "yes"},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		IgnoreUntaggedFields: true,
+		Result:               &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if result.Name != "foo" || result.Port != 8080 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result.Cache != nil || result.internal != "" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Without the option the untagged exported field matches by name.
+	result = Config{}
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Cache == nil {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_FieldHooks(t *testing.T) {
+	type Server struct {
+		Name string `mapstructure:"name"`
+	}
+	type Client struct {
+		Name string `mapstructure:"name"`
+	}
+	type Config struct {
+		Server Server `mapstructure:"server"`
+		Client Client `mapstructure:"client"`
+	}
+
+	upper := func(f, t reflect.Kind, data interface{}) (interface{}, error) {
+		return strings.ToUpper(data.(string)), nil
+	}
+	lower := func(f, t reflect.Kind, data interface{}) (interface{}, error) {
+		return strings.ToLower(data.(string)), nil
+	}
+
+	input := map[string]interface{}{
+		"server": map[string]interface{}{"name": "Alpha"},
+		"client": map[string]interface{}{"name": "Alpha"},
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		FieldHooks: map[reflect.Type]map[string]DecodeHookFunc{
+			reflect.TypeOf(Server{}): {"Name": upper},
+			reflect.TypeOf(Client{}): {"Name": lower},
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Same-named fields on different structs get different hooks.
+	if result.Server.Name != "ALPHA" || result.Client.Name != "alpha" {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// An explicitly nil value skips the field hook and takes the
+	// normal nil path instead of panicking.
+	result = Config{Server: Server{Name: "keep"}}
+	if err := decoder.Decode(map[string]interface{}{
+		"server": map[string]interface{}{"name": nil},
+	}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Server.Name != "keep" {
+		t.Fatalf("bad: %#v", result.Server.Name)
+	}
+}
+
+func TestDecoder_PreserveEmptyCollections(t *testing.T) {
+	type Config struct {
+		Tags   []string          `mapstructure:"tags"`
+		Labels map[string]string `mapstructure:"labels"`
+	}
+
+	nilInput := map[string]interface{}{
+		"tags":   []string(nil),
+		"labels": map[string]string(nil),
+	}
+
+	// Default: nil sources leave nil targets.
+	var result Config
+	if err := Decode(nilInput, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Tags != nil || result.Labels != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// PreserveEmptyCollections: nil sources produce empty values.
+	result = Config{}
+	decoder, err := NewDecoder(&DecoderConfig{
+		PreserveEmptyCollections: true,
+		Result:                   &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(nilInput); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Tags == nil || len(result.Tags) != 0 {
+		t.Fatalf("bad: %#v", result.Tags)
+	}
+	if result.Labels == nil || len(result.Labels) != 0 {
+		t.Fatalf("bad: %#v", result.Labels)
+	}
+
+	// Empty but non-nil sources are non-nil under either setting.
+	emptyInput := map[string]interface{}{
+		"tags":   []string{},
+		"labels": map[string]string{},
+	}
+	result = Config{}
+	if err := Decode(emptyInput, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Tags == nil || result.Labels == nil {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestDecoder_DecodeHookRunsAfterBuiltin(t *testing.T) {
+	var calls int
+	hook := func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		calls++
+		if f.Kind() == reflect.String && t.Kind() == reflect.Int && data.(string) == "ten" {
+			return 10, nil
+		}
+		return data, nil
+	}
+
+	type Config struct {
+		Count int `mapstructure:"count"`
+	}
+
+	// Native conversions never invoke the hook.
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		DecodeHook:                 hook,
+		DecodeHookRunsAfterBuiltin: true,
+		Result:                     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"count": 5}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Count != 5 {
+		t.Fatalf("bad: %#v", result.Count)
+	}
+	if calls != 0 {
+		t.Fatalf("hook ran %d times, expected 0", calls)
+	}
+
+	// The hook fires only once the built-in conversion fails.
+	result = Config{}
+	var md Metadata
+	decoder, err = NewDecoder(&DecoderConfig{
+		DecodeHook:                 hook,
+		DecodeHookRunsAfterBuiltin: true,
+		Metadata:                   &md,
+		Result:                     &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"count": "ten"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Count != 10 {
+		t.Fatalf("bad: %#v", result.Count)
+	}
+	if calls != 1 {
+		t.Fatalf("hook ran %d times, expected 1", calls)
+	}
+
+	// The retried key is recorded once, not once per attempt.
+	if !reflect.DeepEqual(md.Keys, []string{"count"}) {
+		t.Fatalf("bad keys: %#v", md.Keys)
+	}
+}
+
+func TestDecoder_ErrorFormatter(t *testing.T) {
+	type Config struct {
+		Port int `mapstructure:"port"`
+	}
+
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ErrorFormatter: func(path string, expected, actual reflect.Type) error {
+			return fmt.Errorf("%s must be a %s (got %s)", path, expected, actual)
+		},
+		Result: &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = decoder.Decode(map[string]interface{}{"port": []string{"nope"}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "port must be a int (got []string)") {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestDecode_sliceOfPointers(t *testing.T) {
+	type Item struct {
+		Name string `mapstructure:"name"`
+	}
+	var result struct {
+		Items []*Item `mapstructure:"items"`
+	}
+
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a"},
+			nil,
+			map[string]interface{}{"name": "b"},
+		},
+	}
+
+	if err := Decode(input, &result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(result.Items) != 3 {
+		t.Fatalf("bad: %#v", result.Items)
+	}
+	if result.Items[0] == nil || result.Items[0].Name != "a" {
+		t.Fatalf("bad: %#v", result.Items[0])
+	}
+	if result.Items[1] != nil {
+		t.Fatalf("bad: %#v", result.Items[1])
+	}
+	if result.Items[2] == nil || result.Items[2].Name != "b" {
+		t.Fatalf("bad: %#v", result.Items[2])
+	}
+}
+
+func TestDecoderConfig_With(t *testing.T) {
+	base := &DecoderConfig{
+		TagName: "json",
+	}
+
+	derived := base.With(
+		WithTagName("conf"),
+		WithWeaklyTypedInput(true),
+		WithSquash(true),
+	)
+
+	if derived.TagName != "conf" || !derived.WeaklyTypedInput || !derived.Squash {
+		t.Fatalf("bad: %#v", derived)
+	}
+
+	// The base config is unchanged.
+	if base.TagName != "json" || base.WeaklyTypedInput || base.Squash {
+		t.Fatalf("base mutated: %#v", base)
+	}
+
+	// The copy is usable as-is.
+	var result struct {
+		Port int `conf:"port"`
+	}
+	derived.Result = &result
+	decoder, err := NewDecoder(derived)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{"port": "80"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Port != 80 {
+		t.Fatalf("bad: %#v", result.Port)
+	}
+}
+
+func TestNewDecoderWith(t *testing.T) {
+	// Result is required.
+	if _, err := NewDecoderWith(); err == nil {
+		t.Fatal("expected error without WithResult")
+	}
+
+	var result struct {
+		Port    int    `conf:"port"`
+		Created string `conf:"created"`
+	}
+	var md Metadata
+
+	hook := func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() == reflect.String && t.Kind() == reflect.String {
+			return strings.ToUpper(data.(string)), nil
+		}
+		return data, nil
+	}
+
+	decoder, err := NewDecoderWith(
+		WithResult(&result),
+		WithTagName("conf"),
+		WithWeaklyTypedInput(true),
+		WithDecodeHook(hook),
+		WithMetadata(&md),
+	)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	input := map[string]interface{}{
+		"port":    "80",
+		"created": "now",
+		"extra":   true,
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// WithTagName and WithWeaklyTypedInput: string "80" landed in port.
+	if result.Port != 80 {
+		t.Fatalf("bad: %#v", result.Port)
+	}
+	// WithDecodeHook ran.
+	if result.Created != "NOW" {
+		t.Fatalf("bad: %#v", result.Created)
+	}
+	// WithMetadata collected the unused key.
+	if !reflect.DeepEqual(md.Unused, []string{"extra"}) {
+		t.Fatalf("bad: %#v", md.Unused)
+	}
+}
+
+func TestMetadata_sourceKeySpelling(t *testing.T) {
+	type Inner struct {
+		Token string
+	}
+	type Config struct {
+		Name   string
+		Nested Inner
+	}
+
+	// Keys mixing cases that only match case-insensitively.
+	input := map[string]interface{}{
+		"NAME": "foo",
+		"nEsTeD": map[string]interface{}{
+			"TOKEN": "secret",
+		},
+	}
+
+	var md Metadata
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		Metadata: &md,
+		Result:   &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(input); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Keys carry the exact source spelling, FieldPaths the struct
+	// side, aligned index for index.
+	byField := map[string]string{}
+	for i, fieldPath := range md.FieldPaths {
+		byField[fieldPath] = md.Keys[i]
+	}
+
+	expected := map[string]string{
+		"Name":         "NAME",
+		"Nested":       "nEsTeD",
+		"Nested.Token": "nEsTeD.TOKEN",
+	}
+	if !reflect.DeepEqual(byField, expected) {
+		t.Fatalf("bad: %#v", byField)
+	}
+}
+
+func TestErrorOnMissingRequired_withDefault(t *testing.T) {
+	type Config struct {
+		Port int `mapstructure:"port,default=8080,required"`
+	}
+
+	// A field whose default was applied is not missing.
+	var result Config
+	decoder, err := NewDecoder(&DecoderConfig{
+		ApplyDefaults:          true,
+		ErrorOnMissingRequired: true,
+		Result:                 &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result.Port != 8080 {
+		t.Fatalf("bad: %#v", result.Port)
+	}
+
+	// Without ApplyDefaults the default is inert and required fires.
+	result = Config{}
+	decoder, err = NewDecoder(&DecoderConfig{
+		ErrorOnMissingRequired: true,
+		Result:                 &result,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := decoder.Decode(map[string]interface{}{}); err == nil {
+		t.Fatal("error should exist")
+	}
+}